@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Gateway is the subset of *discordgo.Session used by the bot, so a fake gateway can back it in tests
+type Gateway interface {
+	Open() error
+	Close() error
+	AddHandler(handler interface{}) func()
+	ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+type Bot struct {
+	gateway Gateway
+	appID   string
+	guildID string
+}
+
+func New(gateway Gateway, appID string, guildID string) *Bot {
+	return &Bot{
+		gateway: gateway,
+		appID:   appID,
+		guildID: guildID,
+	}
+}
+
+// Start connects to the gateway and registers the slash commands in the guild
+func (b *Bot) Start() error {
+	b.gateway.AddHandler(func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		b.HandleInteraction(i.Interaction)
+	})
+
+	if err := b.gateway.Open(); err != nil {
+		return fmt.Errorf("error opening gateway connection: %w", err)
+	}
+
+	if _, err := b.gateway.ApplicationCommandBulkOverwrite(b.appID, b.guildID, commands); err != nil {
+		b.gateway.Close()
+		return fmt.Errorf("error registering slash commands: %w", err)
+	}
+
+	fmt.Println("Discord bot connected to gateway")
+	return nil
+}
+
+func (b *Bot) Stop() error {
+	return b.gateway.Close()
+}
+
+// StartFromEnv starts a bot on a new gateway session using BOT_TOKEN, CLIENT_ID and GUILD_ID.
+// Only one replica should run the bot, so it is opt in through DISCORD_BOT_ENABLED.
+func StartFromEnv() (*Bot, error) {
+	if os.Getenv("DISCORD_BOT_ENABLED") != "true" {
+		return nil, nil
+	}
+
+	session, err := discordgo.New("Bot " + os.Getenv("BOT_TOKEN"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating discord session: %w", err)
+	}
+	session.Identify.Intents = discordgo.IntentsGuilds
+
+	b := New(session, os.Getenv("CLIENT_ID"), os.Getenv("GUILD_ID"))
+	if err := b.Start(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
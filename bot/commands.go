@@ -0,0 +1,309 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/utmmcss/deerhacks-backend/controllers"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+var statusDescriptions = map[models.Status]string{
+	models.Pending:     "Pending email verification",
+	models.Registering: "Email verified, registering for DeerHacks",
+	models.Applied:     "Application submitted",
+	models.Selected:    "Selected to attend DeerHacks, pending your RSVP",
+	models.Accepted:    "Accepted to attend DeerHacks",
+	models.Rejected:    "Application not accepted",
+	models.Attended:    "Signed in at DeerHacks",
+	models.Admin:       "DeerHacks Organizer",
+	models.Moderator:   "DeerHacks Moderator",
+	models.Volunteer:   "DeerHacks Volunteer",
+	models.Guest:       "DeerHacks Guest",
+	models.Sponsor:     "DeerHacks Sponsor",
+}
+
+func checkInContextChoices() []*discordgo.ApplicationCommandOptionChoice {
+	contexts := append(append([]controllers.QRCheckInContext{}, controllers.QRCheckInContexts...), controllers.ACTIVITY)
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, context := range contexts {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  string(context),
+			Value: string(context),
+		})
+	}
+	return choices
+}
+
+var commands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "status",
+		Description: "Show your DeerHacks status",
+	},
+	{
+		Name:        "qr",
+		Description: "Get your check in QR code in your DMs",
+	},
+	{
+		Name:        "team",
+		Description: "Show your team, its members and its channel",
+	},
+	{
+		Name:        "lookup",
+		Description: "Staff only: look up a user by Discord user or QR code",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Discord user to look up",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "qr",
+				Description: "QR code to look up",
+			},
+		},
+	},
+	{
+		Name:        "checkin",
+		Description: "Staff only: check in a user by QR code",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "qr",
+				Description: "QR code of the user checking in",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "context",
+				Description: "What the user is checking in for",
+				Required:    true,
+				Choices:     checkInContextChoices(),
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "activity",
+				Description: "Activity slug, for the activity context",
+			},
+		},
+	},
+}
+
+// HandleInteraction dispatches a slash command interaction to its handler
+func (b *Bot) HandleInteraction(i *discordgo.Interaction) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	callerId := interactionUserId(i)
+	if callerId == "" {
+		return
+	}
+
+	var caller models.User
+	initializers.DB.First(&caller, "discord_id = ?", callerId)
+
+	if caller.ID == 0 {
+		b.respond(i, "You don't have a DeerHacks account yet. Sign up at https://deerhacks.ca")
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	options := make(map[string]string)
+	for _, option := range data.Options {
+		options[option.Name] = fmt.Sprint(option.Value)
+	}
+
+	switch data.Name {
+	case "status":
+		b.handleStatus(i, &caller)
+	case "qr":
+		b.handleQR(i, &caller)
+	case "team":
+		b.handleTeam(i, &caller)
+	case "lookup":
+		b.handleLookup(i, &caller, options)
+	case "checkin":
+		b.handleCheckIn(i, &caller, options)
+	default:
+		b.respond(i, "Unknown command")
+	}
+}
+
+func interactionUserId(i *discordgo.Interaction) string {
+	// Member is set in guilds, User is set in DMs
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+func isStaff(user *models.User) bool {
+	return user.Status == models.Admin || user.Status == models.Moderator || user.Status == models.Volunteer
+}
+
+// Responds to the interaction with a message only the caller can see
+func (b *Bot) respond(i *discordgo.Interaction, content string) {
+	err := b.gateway.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		fmt.Printf("Failed to respond to interaction (bot.respond): %s\n", err)
+	}
+}
+
+func (b *Bot) handleStatus(i *discordgo.Interaction, caller *models.User) {
+	description, ok := statusDescriptions[caller.Status]
+	if !ok {
+		description = "Unknown"
+	}
+	b.respond(i, fmt.Sprintf("Your DeerHacks status is **%s**: %s", caller.Status, description))
+}
+
+func (b *Bot) handleQR(i *discordgo.Interaction, caller *models.User) {
+	png, err := helpers.GenerateQRCodePNG(caller.QRCode, 512)
+	if err != nil {
+		fmt.Println("handleQR - ", err)
+		b.respond(i, "Failed to generate your QR code, please try again later")
+		return
+	}
+
+	channel, err := b.gateway.UserChannelCreate(caller.DiscordId)
+	if err != nil {
+		fmt.Println("handleQR - ", err)
+		b.respond(i, "Could not DM you, make sure DMs from server members are enabled")
+		return
+	}
+
+	_, err = b.gateway.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{
+		Content: "Here is your DeerHacks check in QR code. Show it to an organizer when you arrive!",
+		Files: []*discordgo.File{{
+			Name:        "deerhacks-qr.png",
+			ContentType: "image/png",
+			Reader:      bytes.NewReader(png),
+		}},
+	})
+	if err != nil {
+		fmt.Println("handleQR - ", err)
+		b.respond(i, "Could not DM you, make sure DMs from server members are enabled")
+		return
+	}
+
+	b.respond(i, "Check your DMs for your QR code!")
+}
+
+func (b *Bot) handleTeam(i *discordgo.Interaction, caller *models.User) {
+	var membership models.TeamMember
+	initializers.DB.Limit(1).Find(&membership, "discord_id = ?", caller.DiscordId)
+
+	var team models.Team
+	if membership.ID != 0 {
+		initializers.DB.Limit(1).Find(&team, membership.TeamId)
+	}
+
+	if team.ID == 0 {
+		b.respond(i, "You are not on a team yet, ask an organizer to add you to one")
+		return
+	}
+
+	var memberIds []string
+	if err := initializers.DB.Model(&models.TeamMember{}).Where("team_id = ?", team.ID).Order("created_at ASC").Pluck("discord_id", &memberIds).Error; err != nil {
+		fmt.Println("handleTeam - ", err)
+		b.respond(i, "Failed to fetch your team, please try again later")
+		return
+	}
+
+	b.respond(i, teamMessage(&team, memberIds))
+}
+
+// Describes the team with its members and text channel as mentions, which Discord shows as names
+func teamMessage(team *models.Team, memberIds []string) string {
+	mentions := make([]string, 0, len(memberIds))
+	for _, memberId := range memberIds {
+		mentions = append(mentions, "<@"+memberId+">")
+	}
+
+	message := fmt.Sprintf("Your team is **%s**", team.Name)
+	if team.Archived {
+		message += " (archived)"
+	}
+	message += "\nMembers: " + strings.Join(mentions, ", ")
+
+	if team.TextChannelId != "" {
+		message += "\nChannel: <#" + team.TextChannelId + ">"
+	} else {
+		message += "\nChannel: not created yet"
+	}
+	return message
+}
+
+func (b *Bot) handleLookup(i *discordgo.Interaction, caller *models.User, options map[string]string) {
+	// Same permissions as AdminUserGet
+	if caller.Status != models.Admin && caller.Status != models.Moderator {
+		b.respond(i, "Admins or Moderators only")
+		return
+	}
+
+	var user models.User
+	if discordId, ok := options["user"]; ok {
+		initializers.DB.First(&user, "discord_id = ?", discordId)
+	} else if qrCode, ok := options["qr"]; ok {
+		user = controllers.FindUserByQRCode(qrCode)
+	} else {
+		b.respond(i, "Provide a user or a QR code to look up")
+		return
+	}
+
+	if user.ID == 0 {
+		b.respond(i, "User not found")
+		return
+	}
+
+	checkIns := "none"
+	if len(user.CheckIns) > 0 {
+		var parsed map[string]int
+		if json.Unmarshal(user.CheckIns, &parsed) == nil && len(parsed) > 0 {
+			var parts []string
+			for context, count := range parsed {
+				parts = append(parts, fmt.Sprintf("%s: %d", context, count))
+			}
+			checkIns = strings.Join(parts, ", ")
+		}
+	}
+
+	b.respond(i, fmt.Sprintf("**%s %s** (%s)\nEmail: %s\nStatus: %s\nCheck ins: %s",
+		user.FirstName, user.LastName, user.Username, user.Email, user.Status, checkIns))
+}
+
+func (b *Bot) handleCheckIn(i *discordgo.Interaction, caller *models.User, options map[string]string) {
+	// Same permissions as AdminQRCheckIn
+	if !isStaff(caller) {
+		b.respond(i, "Admin, moderator, or volunteer only")
+		return
+	}
+
+	status, response := controllers.CheckInUser(caller, options["qr"], controllers.QRCheckInContext(options["context"]), options["activity"])
+
+	if message, ok := response["message"]; ok {
+		b.respond(i, fmt.Sprint(message))
+	} else if status != http.StatusOK {
+		b.respond(i, fmt.Sprintf("Check in failed: %v", response["error"]))
+	} else {
+		b.respond(i, "Checked in successfully")
+	}
+}
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+// Records what the bot sends instead of talking to Discord
+type stubGateway struct {
+	responses []*discordgo.InteractionResponse
+	dmUserIds []string
+	messages  []*discordgo.MessageSend
+	dmErr     error
+}
+
+func (g *stubGateway) Open() error  { return nil }
+func (g *stubGateway) Close() error { return nil }
+
+func (g *stubGateway) AddHandler(handler interface{}) func() { return func() {} }
+
+func (g *stubGateway) ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	return commands, nil
+}
+
+func (g *stubGateway) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	g.responses = append(g.responses, resp)
+	return nil
+}
+
+func (g *stubGateway) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	if g.dmErr != nil {
+		return nil, g.dmErr
+	}
+	g.dmUserIds = append(g.dmUserIds, recipientID)
+	return &discordgo.Channel{ID: "dm-" + recipientID}, nil
+}
+
+func (g *stubGateway) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	g.messages = append(g.messages, data)
+	return &discordgo.Message{ChannelID: channelID}, nil
+}
+
+// Returns the content of the only response, failing if there is not exactly one or it is not ephemeral
+func onlyResponse(t *testing.T, gateway *stubGateway) string {
+	t.Helper()
+	if len(gateway.responses) != 1 {
+		t.Fatalf("got %d responses, want 1", len(gateway.responses))
+	}
+	data := gateway.responses[0].Data
+	if data.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		t.Errorf("response is not ephemeral")
+	}
+	return data.Content
+}
+
+func commandInteraction(name string) *discordgo.Interaction {
+	return &discordgo.Interaction{
+		Type: discordgo.InteractionApplicationCommand,
+		Data: discordgo.ApplicationCommandInteractionData{Name: name},
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	gateway := &stubGateway{}
+	b := New(gateway, "app", "guild")
+
+	b.handleStatus(commandInteraction("status"), &models.User{Status: models.Accepted})
+
+	content := onlyResponse(t, gateway)
+	if !strings.Contains(content, "**accepted**") || !strings.Contains(content, statusDescriptions[models.Accepted]) {
+		t.Errorf("unexpected status response %q", content)
+	}
+}
+
+func TestHandleQR(t *testing.T) {
+	gateway := &stubGateway{}
+	b := New(gateway, "app", "guild")
+
+	b.handleQR(commandInteraction("qr"), &models.User{DiscordId: "123", QRCode: "qr-code"})
+
+	if len(gateway.dmUserIds) != 1 || gateway.dmUserIds[0] != "123" {
+		t.Fatalf("got DM channels for %v, want [123]", gateway.dmUserIds)
+	}
+	if len(gateway.messages) != 1 || len(gateway.messages[0].Files) != 1 || gateway.messages[0].Files[0].ContentType != "image/png" {
+		t.Fatalf("expected one DM with the QR code attached")
+	}
+	if content := onlyResponse(t, gateway); content != "Check your DMs for your QR code!" {
+		t.Errorf("unexpected qr response %q", content)
+	}
+}
+
+func TestHandleQRClosedDMs(t *testing.T) {
+	gateway := &stubGateway{dmErr: errors.New("cannot send messages to this user")}
+	b := New(gateway, "app", "guild")
+
+	b.handleQR(commandInteraction("qr"), &models.User{DiscordId: "123", QRCode: "qr-code"})
+
+	if len(gateway.messages) != 0 {
+		t.Errorf("sent %d DMs, want 0", len(gateway.messages))
+	}
+	if content := onlyResponse(t, gateway); !strings.Contains(content, "Could not DM you") {
+		t.Errorf("unexpected qr response %q", content)
+	}
+}
+
+func TestStaffCommandsRejectParticipants(t *testing.T) {
+	participant := &models.User{Status: models.Accepted}
+
+	gateway := &stubGateway{}
+	New(gateway, "app", "guild").handleLookup(commandInteraction("lookup"), participant, map[string]string{"qr": "qr-code"})
+	if content := onlyResponse(t, gateway); content != "Admins or Moderators only" {
+		t.Errorf("unexpected lookup response %q", content)
+	}
+
+	gateway = &stubGateway{}
+	New(gateway, "app", "guild").handleCheckIn(commandInteraction("checkin"), participant, map[string]string{"qr": "qr-code"})
+	if content := onlyResponse(t, gateway); content != "Admin, moderator, or volunteer only" {
+		t.Errorf("unexpected checkin response %q", content)
+	}
+}
+
+func TestHandleInteractionIgnoresOtherTypes(t *testing.T) {
+	gateway := &stubGateway{}
+	b := New(gateway, "app", "guild")
+
+	b.HandleInteraction(&discordgo.Interaction{Type: discordgo.InteractionMessageComponent})
+	b.HandleInteraction(&discordgo.Interaction{Type: discordgo.InteractionApplicationCommand})
+
+	if len(gateway.responses) != 0 {
+		t.Errorf("got %d responses, want 0", len(gateway.responses))
+	}
+}
+
+func TestTeamMessage(t *testing.T) {
+	team := &models.Team{Name: "Deer Devs", TextChannelId: "555"}
+
+	message := teamMessage(team, []string{"1", "2"})
+	want := "Your team is **Deer Devs**\nMembers: <@1>, <@2>\nChannel: <#555>"
+	if message != want {
+		t.Errorf("got %q, want %q", message, want)
+	}
+
+	team.Archived = true
+	team.TextChannelId = ""
+	message = teamMessage(team, []string{"1"})
+	want = "Your team is **Deer Devs** (archived)\nMembers: <@1>\nChannel: not created yet"
+	if message != want {
+		t.Errorf("got %q, want %q", message, want)
+	}
+}
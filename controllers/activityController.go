@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+var activitySlugPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+type pointHistoryItem struct {
+	Activity  string    `json:"activity"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Returns the users total points and their point history, newest first
+func getUserPoints(discordId string) (int, []pointHistoryItem, error) {
+
+	var transactions []models.PointTransaction
+	err := initializers.DB.Preload("Activity").
+		Where("discord_id = ?", discordId).
+		Order("created_at DESC").
+		Find(&transactions).Error
+	if err != nil {
+		return 0, nil, err
+	}
+
+	total := 0
+	history := []pointHistoryItem{}
+	for _, t := range transactions {
+		item := pointHistoryItem{
+			Points:    t.Points,
+			Reason:    t.Reason,
+			CreatedAt: t.CreatedAt,
+		}
+		if t.Activity != nil {
+			item.Activity = t.Activity.Name
+		}
+		total += t.Points
+		history = append(history, item)
+	}
+
+	return total, history, nil
+}
+
+func activityCheckIn(scannedUser *models.User, slug string, scanner *models.User) (int, gin.H) {
+
+	var activity models.Activity
+	initializers.DB.First(&activity, "slug = ?", slug)
+
+	if activity.ID == 0 || !activity.IsActive {
+		return http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Activity not found or not active",
+		}
+	}
+
+	// Only hackers on site earn points
+	if scannedUser.Status != models.Attended {
+		return http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("%s could not be checked in: User status is not valid for activity context", scannedUser.Username),
+		}
+	}
+
+	transaction := models.PointTransaction{
+		DiscordId:  scannedUser.DiscordId,
+		ActivityId: &activity.ID,
+		Points:     activity.Points,
+		Reason:     "Checked in to " + activity.Name,
+		AwardedBy:  scanner.DiscordId,
+	}
+
+	if err := initializers.DB.Create(&transaction).Error; err != nil {
+		if helpers.IsUniqueViolationError(err) {
+			return http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("%s could not be checked in: Already checked in to %s", scannedUser.Username, activity.Name),
+			}
+		}
+
+		fmt.Println("activityCheckIn - ", err)
+		return http.StatusInternalServerError, gin.H{
+			"error": "Failed to update user",
+		}
+	}
+
+	return http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("%s checked in successfully (+%d points)", scannedUser.Username, activity.Points),
+	}
+}
+
+func AdminActivityList(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator && user.Status != models.Volunteer {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admin, moderator, or volunteer only",
+		})
+		return
+	}
+
+	var activities []models.Activity
+	if err := initializers.DB.Order("id").Find(&activities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch activities",
+		})
+		return
+	}
+
+	activitiesResponse := []gin.H{}
+	for _, activity := range activities {
+		activitiesResponse = append(activitiesResponse, gin.H{
+			"slug":      activity.Slug,
+			"name":      activity.Name,
+			"points":    activity.Points,
+			"is_active": activity.IsActive,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activities": activitiesResponse,
+	})
+}
+
+// AdminActivityUpdate creates the activity with the given slug, or updates it if it already exists.
+func AdminActivityUpdate(c *gin.Context) {
+
+	type ActivityBody struct {
+		Slug     string  `json:"slug"`
+		Name     *string `json:"name,omitempty"`
+		Points   *int    `json:"points,omitempty"`
+		IsActive *bool   `json:"is_active,omitempty"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var bodyData ActivityBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	if !activitySlugPattern.MatchString(bodyData.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid activity slug",
+		})
+		return
+	}
+
+	var activity models.Activity
+	initializers.DB.First(&activity, "slug = ?", bodyData.Slug)
+
+	if activity.ID == 0 {
+		activity = models.Activity{Slug: bodyData.Slug, IsActive: true}
+	}
+
+	if bodyData.Name != nil {
+		activity.Name = *bodyData.Name
+	}
+	if bodyData.Points != nil {
+		if *bodyData.Points < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Points must not be negative",
+			})
+			return
+		}
+		activity.Points = *bodyData.Points
+	}
+	if bodyData.IsActive != nil {
+		activity.IsActive = *bodyData.IsActive
+	}
+
+	if activity.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Activity name is required",
+		})
+		return
+	}
+
+	if initializers.DB.Save(&activity).Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update activity",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+type leaderboardEntry struct {
+	DiscordId string `json:"discord_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+	Status    string `json:"status"`
+	Points    int64  `json:"points"`
+}
+
+func getLeaderboard(statuses []string, limit int) ([]leaderboardEntry, error) {
+
+	query := initializers.DB.Table("point_transactions").
+		Select("users.discord_id, users.first_name, users.last_name, users.username, users.status, SUM(point_transactions.points) AS points").
+		Joins("join users on users.discord_id = point_transactions.discord_id").
+		Where("point_transactions.deleted_at IS NULL AND users.deleted_at IS NULL").
+		Group("users.discord_id, users.first_name, users.last_name, users.username, users.status").
+		Having("SUM(point_transactions.points) > 0").
+		Order("points DESC, users.discord_id")
+
+	if len(statuses) > 0 {
+		query = query.Where("users.status IN (?)", statuses)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	entries := []leaderboardEntry{}
+	if err := query.Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func AdminLeaderboard(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid limit",
+		})
+		return
+	}
+
+	leaderboard, err := getLeaderboard(nil, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get leaderboard",
+		})
+		fmt.Println("AdminLeaderboard - ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"leaderboard": leaderboard,
+	})
+}
+
+// AdminRaffleDraw picks winners without replacement, where each
+// candidate's chance of being drawn is proportional to their points.
+func AdminRaffleDraw(c *gin.Context) {
+
+	type RaffleBody struct {
+		Winners  int      `json:"winners"`
+		Statuses []string `json:"statuses,omitempty"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins only",
+		})
+		return
+	}
+
+	var bodyData RaffleBody
+	if err := c.Bind(&bodyData); err != nil || bodyData.Winners < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	// Defaults to hackers on site
+	if len(bodyData.Statuses) == 0 {
+		bodyData.Statuses = []string{string(models.Attended)}
+	}
+
+	for _, status := range bodyData.Statuses {
+		if _, ok := validStatuses[status]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid status filter provided",
+			})
+			return
+		}
+	}
+
+	candidates, err := getLeaderboard(bodyData.Statuses, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get raffle candidates",
+		})
+		fmt.Println("AdminRaffleDraw - ", err)
+		return
+	}
+
+	var totalPoints int64
+	for _, candidate := range candidates {
+		totalPoints += candidate.Points
+	}
+
+	winners := []leaderboardEntry{}
+	for len(winners) < bodyData.Winners && len(candidates) > 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(totalPoints))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to draw raffle",
+			})
+			fmt.Println("AdminRaffleDraw - ", err)
+			return
+		}
+
+		// Walk the candidates until the drawn ticket is reached
+		ticket := n.Int64()
+		for i, candidate := range candidates {
+			if ticket < candidate.Points {
+				winners = append(winners, candidate)
+				totalPoints -= candidate.Points
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
+			ticket -= candidate.Points
+		}
+	}
+
+	fmt.Printf("AdminRaffleDraw - %s drew %d winners\n", user.DiscordId, len(winners))
+
+	c.JSON(http.StatusOK, gin.H{
+		"winners": winners,
+	})
+}
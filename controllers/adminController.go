@@ -27,8 +27,29 @@ const (
 	DAY_3_BREAKFAST QRCheckInContext = "day_3_breakfast"
 	DRINK_BAR       QRCheckInContext = "drink_bar"
 	BUBBLE_TEA      QRCheckInContext = "bubble_tea"
+	CHECK_OUT       QRCheckInContext = "check_out" // Final check out, blocked while hardware is outstanding
+
+	// Workshops, sponsor booths and mini-events, identified by an activity slug
+	ACTIVITY QRCheckInContext = "activity"
 )
 
+var QRCheckInContexts = []QRCheckInContext{REGISTRATION, DAY_1_DINNER, DAY_2_BREAKFAST, DAY_2_LUNCH, DAY_2_DINNER, DAY_3_BREAKFAST, DRINK_BAR, BUBBLE_TEA, CHECK_OUT}
+
+var validStatuses = map[string]bool{
+	"pending":     true,
+	"registering": true,
+	"applied":     true,
+	"selected":    true,
+	"accepted":    true,
+	"rejected":    true,
+	"attended":    true,
+	"admin":       true,
+	"moderator":   true,
+	"volunteer":   true,
+	"guest":       true,
+	"sponsor":     true,
+}
+
 func checkInsValidation(rawMsg json.RawMessage) bool {
 	var checkIns map[QRCheckInContext]int
 	err := json.Unmarshal(rawMsg, &checkIns)
@@ -38,7 +59,7 @@ func checkInsValidation(rawMsg json.RawMessage) bool {
 	}
 	for key, val := range checkIns {
 		switch key {
-		case REGISTRATION, DAY_1_DINNER, DAY_2_BREAKFAST, DAY_2_LUNCH, DAY_2_DINNER, DAY_3_BREAKFAST, DRINK_BAR, BUBBLE_TEA:
+		case REGISTRATION, DAY_1_DINNER, DAY_2_BREAKFAST, DAY_2_LUNCH, DAY_2_DINNER, DAY_3_BREAKFAST, DRINK_BAR, BUBBLE_TEA, CHECK_OUT:
 			if val < 0 {
 				return false
 			}
@@ -49,6 +70,15 @@ func checkInsValidation(rawMsg json.RawMessage) bool {
 	return true
 }
 
+// Returns the user associated with the qr code, or an empty user (ID 0) if none exists
+func FindUserByQRCode(qrCode string) models.User {
+	var user models.User
+	if qrCode != "" {
+		initializers.DB.First(&user, "qr_code = ?", qrCode)
+	}
+	return user
+}
+
 func AdminUserGet(c *gin.Context) {
 
 	userObj, _ := c.Get("user")
@@ -74,8 +104,7 @@ func AdminUserGet(c *gin.Context) {
 	}
 
 	// Get user associated with qr code
-	var scannedUser models.User
-	initializers.DB.First(&scannedUser, "qr_code = ?", qr_code)
+	scannedUser := FindUserByQRCode(qr_code)
 
 	if scannedUser.ID == 0 {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -145,6 +174,10 @@ func UpdateAdmin(c *gin.Context) {
 
 	fmt.Println("Received request for admin-user-update: ", bodyObj)
 
+	// Tally of status changes for the staff channel summary
+	statusCounts := make(map[models.Status]int)
+	updatedCount := 0
+
 	var currUser models.User
 	for _, u := range bodyObj.Users {
 		initializers.DB.First(&currUser, "discord_id = ?", u.DiscordID)
@@ -174,7 +207,7 @@ func UpdateAdmin(c *gin.Context) {
 					c.JSON(http.StatusInternalServerError, gin.H{
 						"error": "An Internal Error Occured",
 					})
-					fmt.Errorf("Failed to unmarshal u.Fields for user %d ", currUser.ID)
+					fmt.Printf("Failed to unmarshal u.Fields for user %d\n", currUser.ID)
 					return
 				}
 			} else {
@@ -182,10 +215,11 @@ func UpdateAdmin(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": "An Internal Error Occured",
 				})
-				fmt.Errorf("Failed to marshal u.Fields for user %d ", currUser.ID)
+				fmt.Printf("Failed to marshal u.Fields for user %d\n", currUser.ID)
 				return
 			}
 			// Update the user object with the new information (if applicable)
+			isNameChanged := *bodyData.FirstName != currUser.FirstName || *bodyData.LastName != currUser.LastName
 			currUser.FirstName = *bodyData.FirstName
 			currUser.LastName = *bodyData.LastName
 
@@ -200,15 +234,14 @@ func UpdateAdmin(c *gin.Context) {
 				currUser.Email = email
 			}
 
-			//Make sure moderators cannot update status to admin or moderator
-			if user.Status == models.Moderator && (bodyData.Status == models.Admin || bodyData.Status == models.Moderator) {
+			//Make sure moderators cannot update status to admin or moderator, or give sponsors access to resumes
+			if user.Status == models.Moderator && (bodyData.Status == models.Admin || bodyData.Status == models.Moderator || bodyData.Status == models.Sponsor) {
 				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "Moderators cannot update status to admin or moderator",
+					"error": "Moderators cannot update status to admin, moderator or sponsor",
 				})
 				return
 			} else if u.Fields.Status != "" {
 				currUser.Status = bodyData.Status
-				discord.EnqueueUser(&currUser, "update")
 			}
 
 			currUser.InternalNotes = *bodyData.InternalNotes
@@ -226,12 +259,19 @@ func UpdateAdmin(c *gin.Context) {
 			}
 
 			// Save the updated user object to the database
-			if initializers.DB.Save(&currUser).Error != nil {
+			if err := initializers.DB.Save(&currUser).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": "Failed to update user",
 				})
+				discord.NotifyStaffError(fmt.Sprintf("%s failed to update %s", user.Username, currUser.DiscordId), err)
 				return
 			}
+			updatedCount++
+
+			// Sync the discord roles and nickname once the new status and name are saved
+			if isNameChanged || u.Fields.Status != "" {
+				discord.EnqueueUser(&currUser, "update")
+			}
 		} else {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Moderators cannot update admins or moderators",
@@ -239,6 +279,11 @@ func UpdateAdmin(c *gin.Context) {
 			return
 		}
 
+		if u.Fields.Status != "" {
+			discord.NotifyStatusChange(&currUser)
+			statusCounts[currUser.Status]++
+		}
+
 		// If status is changed to selected send an rsvp email
 		if u.Fields.Status == models.Selected {
 			SetupOutboundEmail(&currUser, "rsvp")
@@ -252,6 +297,14 @@ func UpdateAdmin(c *gin.Context) {
 		currUser = models.User{}
 	}
 
+	if updatedCount > 0 {
+		discord.NotifyStaff("batch_summary", gin.H{
+			"Actor":    user.Username,
+			"Count":    updatedCount,
+			"Statuses": statusCounts,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{})
 }
 
@@ -284,20 +337,6 @@ func GetUserList(c *gin.Context) {
 	// Get search query parameter
 	search := c.DefaultQuery("search", "")
 
-	validStatuses := map[string]bool{
-		"pending":     true,
-		"registering": true,
-		"applied":     true,
-		"selected":    true,
-		"accepted":    true,
-		"rejected":    true,
-		"attended":    true,
-		"admin":       true,
-		"moderator":   true,
-		"volunteer":   true,
-		"guest":       true,
-	}
-
 	//return error if status is not valid
 	for _, status := range statuses {
 		if _, ok := validStatuses[status]; !ok {
@@ -348,11 +387,14 @@ func GetUserList(c *gin.Context) {
 		query = query.Where(strings.Join(internalStatusConditions, " OR "), queryParams...)
 	}
 
-	// Modify the database query to apply the search filter if provided
+	// Modify the database query to apply the search filter if provided, matching user details or resume keywords
 	if search != "" {
+		resumeMatches := initializers.DB.Model(&models.Application{}).
+			Select("discord_id").
+			Where("resume_search @@ "+resumeSearchQuery, search)
 		query = query.Where(
-			"users.discord_id ILIKE ? OR users.first_name ILIKE ? OR users.last_name ILIKE ? OR users.username ILIKE ? OR users.email ILIKE ? OR users.internal_notes ILIKE ?",
-			"%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%",
+			"users.discord_id ILIKE ? OR users.first_name ILIKE ? OR users.last_name ILIKE ? OR users.username ILIKE ? OR users.email ILIKE ? OR users.internal_notes ILIKE ? OR users.discord_id IN (?)",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%", resumeMatches,
 		)
 	}
 
@@ -396,6 +438,7 @@ func GetUserList(c *gin.Context) {
 			userResponse["internal_notes"] = userApp.InternalNotes
 			userResponse["check_ins"] = userApp.CheckIns
 			userResponse["qr_code"] = userApp.QRCode
+			userResponse["token_revoked"] = userApp.TokenRevoked
 
 			// Users without applications
 			if userApp.Application.Model.ID == 0 {
@@ -409,16 +452,12 @@ func GetUserList(c *gin.Context) {
 			userResponse["application"] = appResponse.Application
 
 			// Call the helper function to get resume details
-			resumeFilename, resumeLink, err := GetResumeDetails(&userApp.User, &userApp.Application)
-			if err != nil {
-				// Handle the error appropriately
-				fmt.Println("Error getting resume details: ", err)
-				continue // or you can handle it differently based on your application's needs
-			}
+			resumeFilename, resumeLink := GetResumeDetails(&userApp.Application)
 
 			// Append the resume information to the user response
 			userResponse["resume_file_name"] = resumeFilename
 			userResponse["resume_link"] = resumeLink
+			userResponse["resume_scan_status"] = userApp.ResumeScanStatus
 
 			// Add the response for the current user to the usersResponse slice
 			usersResponse = append(usersResponse, userResponse)
@@ -444,6 +483,7 @@ func GetUserList(c *gin.Context) {
 			userResponse["internal_notes"] = user.InternalNotes
 			userResponse["check_ins"] = user.CheckIns
 			userResponse["qr_code"] = user.QRCode
+			userResponse["token_revoked"] = user.TokenRevoked
 
 			usersResponse = append(usersResponse, userResponse)
 		}
@@ -480,8 +520,9 @@ func AdminQRCheckIn(c *gin.Context) {
 	}
 
 	type QRCheckIn struct {
-		QRid    string           `json:"qrId"`
-		Context QRCheckInContext `json:"context"`
+		QRid     string           `json:"qrId"`
+		Context  QRCheckInContext `json:"context"`
+		Activity string           `json:"activity,omitempty"`
 	}
 	var bodyData QRCheckIn
 
@@ -503,36 +544,63 @@ func AdminQRCheckIn(c *gin.Context) {
 
 	fmt.Println("Received request for qr check in: ", bodyData)
 
-	switch bodyData.Context {
-	case REGISTRATION, DAY_1_DINNER, DAY_2_BREAKFAST, DAY_2_LUNCH, DAY_2_DINNER, DAY_3_BREAKFAST, DRINK_BAR, BUBBLE_TEA:
+	status, response := CheckInUser(&user, bodyData.QRid, bodyData.Context, bodyData.Activity)
+	c.JSON(status, response)
+}
+
+// CheckInUser checks in the user with the given qr code for a context on behalf of the scanner,
+// returning the HTTP status and response body. Shared by AdminQRCheckIn and the Discord bot.
+func CheckInUser(scanner *models.User, qrCode string, context QRCheckInContext, activity string) (int, gin.H) {
+
+	switch context {
+	case REGISTRATION, DAY_1_DINNER, DAY_2_BREAKFAST, DAY_2_LUNCH, DAY_2_DINNER, DAY_3_BREAKFAST, DRINK_BAR, BUBBLE_TEA, CHECK_OUT, ACTIVITY:
 		// Valid context, proceed
 	default:
 		// Invalid context, return an error
-		c.JSON(http.StatusBadRequest, gin.H{
+		return http.StatusBadRequest, gin.H{
 			"error": "Invalid context",
-		})
-		return
+		}
 	}
 
 	//Get the user scanning in
-	var scannedUser models.User
-	initializers.DB.First(&scannedUser, "qr_code = ?", bodyData.QRid)
+	scannedUser := FindUserByQRCode(qrCode)
 	// If qr_code does not exist, return error
 	if scannedUser.ID == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
+		return http.StatusNotFound, gin.H{
 			"error": "User not found",
-		})
-		return
+		}
 	}
 
+	if context == ACTIVITY {
+		// Activity check ins award points instead of updating CheckIns
+		return activityCheckIn(&scannedUser, activity, scanner)
+	}
+
+	isStatusChanged := false
+
 	if scannedUser.Status == models.Admin {
 		// Return success if scanning in admins
-		c.JSON(http.StatusOK, gin.H{
+		return http.StatusOK, gin.H{
 			"success": true,
 			"message": fmt.Sprintf("%s checked in successfully", scannedUser.Username),
-		})
-		return
-	} else if bodyData.Context != REGISTRATION {
+		}
+	} else if context != REGISTRATION {
+		// Users must return all borrowed hardware before checking out
+		if context == CHECK_OUT {
+			outstanding, err := countOutstandingHardware(scannedUser.DiscordId)
+			if err != nil {
+				return http.StatusInternalServerError, gin.H{
+					"error": "Failed to check outstanding hardware",
+				}
+			}
+			if outstanding > 0 {
+				return http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": fmt.Sprintf("%s could not be checked out: %d hardware item(s) have not been returned", scannedUser.Username, outstanding),
+				}
+			}
+		}
+
 		// Scanning in for food contexts
 		var checkIns map[QRCheckInContext]int
 		if scannedUser.CheckIns == nil {
@@ -541,80 +609,85 @@ func AdminQRCheckIn(c *gin.Context) {
 			err := json.Unmarshal(scannedUser.CheckIns, &checkIns)
 			if err != nil {
 				fmt.Println("Error unmarshalling CheckIns:", err)
-				return
+				return http.StatusInternalServerError, gin.H{
+					"error": "Failed to update user",
+				}
 			}
 		}
 
-		value, exists := checkIns[bodyData.Context]
+		value, exists := checkIns[context]
 		if exists && ((scannedUser.Status == models.Moderator && value < 3) || (scannedUser.Status == models.Volunteer && value < 2)) {
-			checkIns[bodyData.Context] += 1
+			checkIns[context] += 1
 		} else if !exists && (scannedUser.Status == models.Moderator || scannedUser.Status == models.Volunteer || scannedUser.Status == models.Attended || scannedUser.Status == models.Guest) {
-			checkIns[bodyData.Context] = 1
+			checkIns[context] = 1
 		} else if exists {
-			c.JSON(http.StatusBadRequest, gin.H{
+			return http.StatusBadRequest, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("%s could not be checked in: Reached maximum number of check ins for this meal", scannedUser.Username),
-			})
-			return
+			}
 		} else {
-			c.JSON(http.StatusBadRequest, gin.H{
+			return http.StatusBadRequest, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("%s could not be checked in: User status is not valid for food context", scannedUser.Username),
-			})
-			return
+			}
 		}
 
 		//Marshal checkIns to save to database
 		checkInsData, err := json.Marshal(checkIns)
 		if err != nil {
 			fmt.Println("Error marshalling CheckIns:", err)
-			return
+			return http.StatusInternalServerError, gin.H{
+				"error": "Failed to update user",
+			}
 		}
 		scannedUser.CheckIns = checkInsData
-	} else if user.Status == models.Admin || user.Status == models.Moderator {
+	} else if scanner.Status == models.Admin || scanner.Status == models.Moderator {
 		// Scanning in for registration
 		if scannedUser.Status == models.Accepted {
 			scannedUser.Status = models.Attended
-			discord.EnqueueUser(&scannedUser, "update")
+			isStatusChanged = true
 		} else if scannedUser.Status == models.Moderator || scannedUser.Status == models.Volunteer || scannedUser.Status == models.Guest {
-			c.JSON(http.StatusOK, gin.H{
+			return http.StatusOK, gin.H{
 				"success": true,
 				"message": fmt.Sprintf("%s checked in successfully", scannedUser.Username),
-			})
-			return
+			}
 		} else if scannedUser.Status == models.Attended {
-			c.JSON(http.StatusBadRequest, gin.H{
+			return http.StatusBadRequest, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("%s could not be checked in: Hacker has already scanned in for registration", scannedUser.Username),
-			})
-			return
+			}
 		} else {
-			c.JSON(http.StatusBadRequest, gin.H{
+			return http.StatusBadRequest, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("%s could not be checked in: Status is not valid for checkin", scannedUser.Username),
-			})
-			return
+			}
 		}
 
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{
+		return http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("%s could not be checked in: Volunteers are not authorized to scan in for registration contexts", scannedUser.Username),
-		})
-		return
+		}
 	}
 
 	// Save scanned user to database
-	err = initializers.DB.Save(&scannedUser).Error
+	err := initializers.DB.Save(&scannedUser).Error
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		return http.StatusInternalServerError, gin.H{
 			"error": "Failed to update user",
-		})
-		return
+		}
 	}
-	c.JSON(http.StatusOK, gin.H{
+
+	// Record the check in for the live attendance dashboard
+	recordCheckIn(&scannedUser, context, scanner)
+
+	if isStatusChanged {
+		discord.EnqueueUser(&scannedUser, "update")
+		discord.NotifyStatusChange(&scannedUser)
+	}
+
+	return http.StatusOK, gin.H{
 		"success": true,
 		"message": fmt.Sprintf("%s checked in successfully", scannedUser.Username),
-	})
-
+	}
 }
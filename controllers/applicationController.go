@@ -150,6 +150,7 @@ func UpdateApplication(c *gin.Context) {
 	application.DietRestriction.Set(bodyData.Application.DietRestriction)
 	application.DeerhacksExperience.Set(bodyData.Application.DeerhacksExperience)
 	application.Interests.Set(bodyData.Application.Interests)
+	application.Skills.Set(bodyData.Application.Skills)
 
 	if copier.Copy(&application, &(bodyData.Application)) != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -170,8 +171,7 @@ func UpdateApplication(c *gin.Context) {
 
 		// Save the updated user and application object to the database
 		user.Status = models.Applied
-		discord.EnqueueUser(&user, "update")
-		initializers.DB.Transaction(func(tx *gorm.DB) error {
+		txErr := initializers.DB.Transaction(func(tx *gorm.DB) error {
 			if err := tx.Save(&user).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": "Failed to update user/application",
@@ -184,9 +184,16 @@ func UpdateApplication(c *gin.Context) {
 				})
 				return err
 			}
-			c.JSON(http.StatusOK, gin.H{})
 			return nil
 		})
+		if txErr != nil {
+			return
+		}
+
+		// Sync the discord roles once the new status is committed
+		discord.EnqueueUser(&user, "update")
+
+		c.JSON(http.StatusOK, gin.H{})
 		return
 	}
 
@@ -187,6 +187,10 @@ func Login(c *gin.Context) {
 		user.RefreshToken = details.RefreshToken
 		user.TokenExpiry = expiry.Format(time.RFC3339)
 
+		// A revoked token may have stopped the user from joining the server, so try again with the new one
+		rejoin := user.TokenRevoked
+		user.TokenRevoked = false
+
 		if user.Avatar != userDetails.Avatar {
 			user.Avatar = userDetails.Avatar
 		}
@@ -196,6 +200,10 @@ func Login(c *gin.Context) {
 		}
 
 		initializers.DB.Save(&user)
+
+		if rejoin {
+			discord.EnqueueUser(&user, "join")
+		}
 	}
 
 	// Generate a jwt token
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+type badgeStyle struct {
+	Label string
+	Color [3]int
+}
+
+// Badge role label and band color (RGB) for each status that can attend DeerHacks
+var badgeStyles = map[models.Status]badgeStyle{
+	models.Selected:  {Label: "HACKER", Color: [3]int{46, 125, 50}},
+	models.Accepted:  {Label: "HACKER", Color: [3]int{46, 125, 50}},
+	models.Attended:  {Label: "HACKER", Color: [3]int{46, 125, 50}},
+	models.Admin:     {Label: "ORGANIZER", Color: [3]int{198, 40, 40}},
+	models.Moderator: {Label: "MODERATOR", Color: [3]int{106, 27, 154}},
+	models.Volunteer: {Label: "VOLUNTEER", Color: [3]int{21, 101, 192}},
+	models.Guest:     {Label: "GUEST", Color: [3]int{239, 108, 0}},
+	models.Sponsor:   {Label: "SPONSOR", Color: [3]int{249, 168, 37}},
+}
+
+var defaultBadgeStyle = badgeStyle{Label: "PARTICIPANT", Color: [3]int{97, 97, 97}}
+
+// Badge layout on a letter page, in inches (2 columns x 3 rows of 4"x3" badges)
+const (
+	badgeWidth   = 4.0
+	badgeHeight  = 3.0
+	badgeColumns = 2
+	badgeRows    = 3
+	badgeMarginX = 0.25
+	badgeMarginY = 1.0
+)
+
+func GetUserQR(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	format := c.DefaultQuery("format", "png")
+
+	switch format {
+	case "png":
+		png, err := helpers.GenerateQRCodePNG(user.QRCode, 512)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			fmt.Println("GetUserQR - ", err)
+			return
+		}
+		c.Data(http.StatusOK, "image/png", png)
+	case "svg":
+		svg, err := helpers.GenerateQRCodeSVG(user.QRCode, 512)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			fmt.Println("GetUserQR - ", err)
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", []byte(svg))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid format, expected png or svg",
+		})
+	}
+}
+
+func AdminBadgesGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	// Defaults to all accepted hackers
+	statuses := strings.Split(c.DefaultQuery("statuses", string(models.Accepted)), ",")
+
+	for _, status := range statuses {
+		if _, ok := validStatuses[status]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid status filter provided",
+			})
+			return
+		}
+	}
+
+	type BadgeUser struct {
+		models.User
+		Pronoun string
+	}
+
+	var badgeUsers []BadgeUser
+	err := initializers.DB.Table("users").
+		Select("users.*, applications.pronoun").
+		Joins("left join applications on applications.discord_id = users.discord_id").
+		Where("users.status IN (?) AND users.deleted_at IS NULL", statuses).
+		Order("users.last_name, users.first_name").
+		Scan(&badgeUsers).Error
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch users",
+		})
+		fmt.Println("AdminBadgesGet - ", err)
+		return
+	}
+
+	pdf := fpdf.New("P", "in", "Letter", "")
+	pdf.SetAutoPageBreak(false, 0)
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+
+	for i, badgeUser := range badgeUsers {
+		slot := i % (badgeColumns * badgeRows)
+		if slot == 0 {
+			pdf.AddPage()
+		}
+
+		x := badgeMarginX + float64(slot%badgeColumns)*badgeWidth
+		y := badgeMarginY + float64(slot/badgeColumns)*badgeHeight
+
+		if err := drawBadge(pdf, translate, x, y, &badgeUser.User, badgeUser.Pronoun); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate badges",
+			})
+			fmt.Println("AdminBadgesGet - ", err)
+			return
+		}
+	}
+
+	// Always return a valid document, even if no users matched
+	if len(badgeUsers) == 0 {
+		pdf.AddPage()
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate badges",
+		})
+		fmt.Println("AdminBadgesGet - ", err)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=\"badges.pdf\"")
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+func drawBadge(pdf *fpdf.Fpdf, translate func(string) string, x float64, y float64, user *models.User, pronoun string) error {
+
+	style, ok := badgeStyles[user.Status]
+	if !ok {
+		style = defaultBadgeStyle
+	}
+
+	// Cut lines
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.SetLineWidth(0.01)
+	pdf.Rect(x, y, badgeWidth, badgeHeight, "D")
+
+	// Role band
+	pdf.SetFillColor(style.Color[0], style.Color[1], style.Color[2])
+	pdf.Rect(x, y, badgeWidth, 0.55, "F")
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.SetXY(x, y)
+	pdf.CellFormat(badgeWidth, 0.55, style.Label, "", 0, "C", false, 0, "")
+
+	firstName := user.FirstName
+	if firstName == "" {
+		firstName = user.Username
+	}
+
+	// Name and pronouns
+	pdf.SetTextColor(24, 24, 24)
+	pdf.SetFont("Helvetica", "B", 24)
+	pdf.SetXY(x+0.2, y+0.8)
+	pdf.CellFormat(2.2, 0.45, translate(firstName), "", 0, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 16)
+	pdf.SetXY(x+0.2, y+1.25)
+	pdf.CellFormat(2.2, 0.35, translate(user.LastName), "", 0, "L", false, 0, "")
+
+	if pronoun != "" {
+		pdf.SetFont("Helvetica", "I", 12)
+		pdf.SetTextColor(97, 97, 97)
+		pdf.SetXY(x+0.2, y+1.7)
+		pdf.CellFormat(2.2, 0.3, translate(pronoun), "", 0, "L", false, 0, "")
+	}
+
+	// QR code
+	png, err := helpers.GenerateQRCodePNG(user.QRCode, 256)
+	if err != nil {
+		return err
+	}
+
+	imageName := "qr-" + user.DiscordId
+	pdf.RegisterImageOptionsReader(imageName, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+	pdf.ImageOptions(imageName, x+badgeWidth-1.6, y+0.8, 1.4, 1.4, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	return pdf.Error()
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/discord"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+// AdminDiscordQueueGet returns the dead lettered discord queue items, along with
+// queue items that are still being retried.
+func AdminDiscordQueueGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var deadLetters []models.DiscordDeadLetter
+	query := initializers.DB.Order("created_at DESC")
+	if event := c.DefaultQuery("event", ""); event != "" {
+		query = query.Where("event = ?", event)
+	}
+	if err := query.Find(&deadLetters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch dead letters",
+		})
+		fmt.Println("AdminDiscordQueueGet - ", err)
+		return
+	}
+
+	deadLettersResponse := []gin.H{}
+	for _, deadLetter := range deadLetters {
+		deadLettersResponse = append(deadLettersResponse, gin.H{
+			"id":         deadLetter.ID,
+			"discord_id": deadLetter.DiscordId,
+			"event":      deadLetter.Event,
+			"attempts":   deadLetter.Attempts,
+			"last_error": deadLetter.LastError,
+			"failed_at":  deadLetter.CreatedAt,
+		})
+	}
+
+	// Team items are keyed by team rather than by user
+	type RetryingItem struct {
+		DiscordId     string     `json:"discord_id,omitempty"`
+		TeamId        uint       `json:"team_id,omitempty"`
+		Attempts      int        `json:"attempts"`
+		NextAttemptAt *time.Time `json:"next_attempt_at"`
+		LastError     string     `json:"last_error"`
+	}
+
+	queues := gin.H{}
+	for event, table := range map[string]string{
+		"join":   models.JoinGuildQueue{}.TableName(),
+		"update": models.UpdateRoleQueue{}.TableName(),
+		"notify": models.DiscordNotification{}.TableName(),
+		"team":   models.TeamChannelQueue{}.TableName(),
+	} {
+		keyColumn := "discord_id"
+		if event == "team" {
+			keyColumn = "team_id"
+		}
+
+		var pending int64
+		if err := initializers.DB.Table(table).Count(&pending).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch discord queues",
+			})
+			fmt.Println("AdminDiscordQueueGet - ", err)
+			return
+		}
+
+		retrying := []RetryingItem{}
+		err := initializers.DB.Table(table).
+			Select(keyColumn + ", attempts, next_attempt_at, last_error").
+			Where("attempts > 0").
+			Order("next_attempt_at").
+			Scan(&retrying).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch discord queues",
+			})
+			fmt.Println("AdminDiscordQueueGet - ", err)
+			return
+		}
+
+		queues[event] = gin.H{
+			"pending":  pending,
+			"retrying": retrying,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dead_letters": deadLettersResponse,
+		"queues":       queues,
+	})
+}
+
+// AdminDiscordDeadLettersRequeue puts the given dead letters, or all of them, back on their queues
+func AdminDiscordDeadLettersRequeue(c *gin.Context) {
+
+	type RequeueBody struct {
+		IDs []uint `json:"ids,omitempty"`
+		All bool   `json:"all,omitempty"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var bodyData RequeueBody
+	if err := c.Bind(&bodyData); err != nil || (len(bodyData.IDs) == 0 && !bodyData.All) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	var deadLetters []models.DiscordDeadLetter
+	query := initializers.DB
+	if !bodyData.All {
+		query = query.Where("id IN ?", bodyData.IDs)
+	}
+	if err := query.Find(&deadLetters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch dead letters",
+		})
+		return
+	}
+
+	requeued := []uint{}
+	failed := gin.H{}
+	for i := range deadLetters {
+		if err := discord.RequeueDeadLetter(&deadLetters[i]); err != nil {
+			failed[fmt.Sprint(deadLetters[i].ID)] = err.Error()
+			continue
+		}
+		requeued = append(requeued, deadLetters[i].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requeued": requeued,
+		"failed":   failed,
+	})
+}
+
+// AdminDiscordReconcile compares the guild's roles against the database and returns a report.
+// Drifted members are enqueued for a role update unless ?dry_run=true is set.
+func AdminDiscordReconcile(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	report, err := discord.ReconcileGuild(c.DefaultQuery("dry_run", "false") == "true")
+	if errors.Is(err, discord.ErrReconcileRunning) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Reconciliation already running",
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to reconcile guild",
+		})
+		fmt.Println("AdminDiscordReconcile - ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/discord"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm"
+)
+
+var snowflakePattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+
+func AdminDiscordRolesGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": discord.RoleMapping(),
+	})
+}
+
+// AdminDiscordRolesUpdate replaces the roles for a status. An empty list of roles
+// removes the override so the status falls back to the configured roles.
+func AdminDiscordRolesUpdate(c *gin.Context) {
+
+	type RolesBody struct {
+		Status string   `json:"status"`
+		Roles  []string `json:"roles"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins only",
+		})
+		return
+	}
+
+	var bodyData RolesBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	if _, ok := validStatuses[bodyData.Status]; !ok && bodyData.Status != discord.DefaultRoleKey {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid status provided",
+		})
+		return
+	}
+
+	for _, role := range bodyData.Roles {
+		if !snowflakePattern.MatchString(role) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid role id provided",
+			})
+			return
+		}
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Soft delete so replaced roles stay managed and are removed from discord on the next sync
+		if err := tx.Where("status = ?", bodyData.Status).Delete(&models.DiscordRoleMapping{}).Error; err != nil {
+			return err
+		}
+		for _, role := range bodyData.Roles {
+			if err := tx.Create(&models.DiscordRoleMapping{Status: bodyData.Status, RoleId: role}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update roles",
+		})
+		fmt.Println("AdminDiscordRolesUpdate - ", err)
+		return
+	}
+
+	if err := discord.LoadRoleMapping(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to reload roles",
+		})
+		fmt.Println("AdminDiscordRolesUpdate - ", err)
+		return
+	}
+	discord.NotifyRoleMappingChanged()
+
+	// Resync the roles of users with the updated status
+	if bodyData.Status != discord.DefaultRoleKey {
+		var users []models.User
+		initializers.DB.Where("status = ?", bodyData.Status).Find(&users)
+		for _, u := range users {
+			discord.EnqueueUser(&u, "update")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": discord.RoleMapping(),
+	})
+}
+
+// AdminUserDiscordRolesUpdate grants or removes extra roles for a single user, on top of their status roles.
+func AdminUserDiscordRolesUpdate(c *gin.Context) {
+
+	type ExtraRole struct {
+		RoleID string `json:"role_id"`
+		Reason string `json:"reason,omitempty"`
+	}
+
+	type UserRolesBody struct {
+		DiscordID string      `json:"discord_id"`
+		Add       []ExtraRole `json:"add,omitempty"`
+		Remove    []string    `json:"remove,omitempty"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var bodyData UserRolesBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	var currUser models.User
+	initializers.DB.First(&currUser, "discord_id = ?", bodyData.DiscordID)
+
+	if currUser.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	for _, role := range bodyData.Add {
+		if !snowflakePattern.MatchString(role.RoleID) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid role id provided",
+			})
+			return
+		}
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if len(bodyData.Remove) > 0 {
+			// Soft delete so the role stays managed and is removed from discord on the next sync
+			if err := tx.Where("discord_id = ? AND role_id IN ?", currUser.DiscordId, bodyData.Remove).Delete(&models.UserDiscordRole{}).Error; err != nil {
+				return err
+			}
+		}
+		for _, role := range bodyData.Add {
+			var existing models.UserDiscordRole
+			tx.First(&existing, "discord_id = ? AND role_id = ?", currUser.DiscordId, role.RoleID)
+			if existing.ID != 0 {
+				continue
+			}
+			extra := models.UserDiscordRole{DiscordId: currUser.DiscordId, RoleId: role.RoleID, Reason: role.Reason}
+			if err := tx.Create(&extra).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update user roles",
+		})
+		fmt.Println("AdminUserDiscordRolesUpdate - ", err)
+		return
+	}
+
+	discord.EnqueueUser(&currUser, "update")
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": discord.UserDiscordRoles(&currUser),
+	})
+}
@@ -366,7 +366,6 @@ func VerifyEmail(c *gin.Context) {
 	}
 
 	user.Status = models.Status(matchingEntry.StatusChange)
-	discord.EnqueueUser(&user, "update")
 	err = initializers.DB.Save(&user).Error
 
 	if err != nil {
@@ -380,6 +379,9 @@ func VerifyEmail(c *gin.Context) {
 
 	fmt.Println("VerifyEmail - Verification succeded for User", user.ID)
 
+	discord.EnqueueUser(&user, "update")
+	discord.NotifyStatusChange(&user)
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"context": matchingEntry.Context,
@@ -388,7 +390,7 @@ func VerifyEmail(c *gin.Context) {
 	err = initializers.DB.Delete(&matchingEntry).Error
 
 	if err != nil {
-		fmt.Printf("VerifyEmail - An error occured when trying to delete an entry:", err)
+		fmt.Println("VerifyEmail - An error occured when trying to delete an entry:", err)
 	}
 
 }
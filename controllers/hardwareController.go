@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Loan length used when a checkout does not specify a due time
+const defaultHardwareLoan = 12 * time.Hour
+
+var errHardwareUnavailable = errors.New("not enough hardware available")
+
+func countOutstandingHardware(discordId string) (int64, error) {
+	var count int64
+	err := initializers.DB.Model(&models.HardwareCheckout{}).
+		Where("discord_id = ? AND returned_at IS NULL", discordId).
+		Count(&count).Error
+	return count, err
+}
+
+// Returns the quantity of an item currently checked out
+func checkedOutQuantity(tx *gorm.DB, itemId uint) (int, error) {
+	var checkedOut int
+	err := tx.Model(&models.HardwareCheckout{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("hardware_item_id = ? AND returned_at IS NULL", itemId).
+		Scan(&checkedOut).Error
+	return checkedOut, err
+}
+
+func toCheckoutResponse(checkout models.HardwareCheckout) gin.H {
+	return gin.H{
+		"id":          checkout.ID,
+		"item_id":     checkout.HardwareItemId,
+		"item_name":   checkout.HardwareItem.Name,
+		"discord_id":  checkout.DiscordId,
+		"quantity":    checkout.Quantity,
+		"checked_out": checkout.CreatedAt,
+		"due_at":      checkout.DueAt,
+		"overdue":     checkout.ReturnedAt == nil && time.Now().After(checkout.DueAt),
+		"returned_at": checkout.ReturnedAt,
+	}
+}
+
+func HardwareList(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator && user.Status != models.Volunteer {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admin, moderator, or volunteer only",
+		})
+		return
+	}
+
+	var items []models.HardwareItem
+	if err := initializers.DB.Order("name").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch hardware",
+		})
+		return
+	}
+
+	itemsResponse := []gin.H{}
+	for _, item := range items {
+		checkedOut, err := checkedOutQuantity(initializers.DB, item.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch hardware",
+			})
+			fmt.Println("HardwareList - ", err)
+			return
+		}
+
+		itemsResponse = append(itemsResponse, gin.H{
+			"id":          item.ID,
+			"name":        item.Name,
+			"description": item.Description,
+			"quantity":    item.Quantity,
+			"available":   item.Quantity - checkedOut,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": itemsResponse,
+	})
+}
+
+// AdminHardwareUpdate creates a new hardware item, or updates the item with the given id.
+func AdminHardwareUpdate(c *gin.Context) {
+
+	type HardwareBody struct {
+		ID          uint    `json:"id,omitempty"`
+		Name        *string `json:"name,omitempty"`
+		Description *string `json:"description,omitempty"`
+		Quantity    *int    `json:"quantity,omitempty"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var bodyData HardwareBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	var item models.HardwareItem
+	if bodyData.ID != 0 {
+		initializers.DB.First(&item, bodyData.ID)
+		if item.ID == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Hardware item not found",
+			})
+			return
+		}
+	}
+
+	if bodyData.Name != nil {
+		item.Name = *bodyData.Name
+	}
+	if bodyData.Description != nil {
+		item.Description = *bodyData.Description
+	}
+	if bodyData.Quantity != nil {
+		if *bodyData.Quantity < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Quantity must not be negative",
+			})
+			return
+		}
+		item.Quantity = *bodyData.Quantity
+	}
+
+	if item.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Hardware name is required",
+		})
+		return
+	}
+
+	if initializers.DB.Save(&item).Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update hardware item",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id": item.ID,
+	})
+}
+
+func HardwareCheckout(c *gin.Context) {
+
+	type CheckoutBody struct {
+		QRid     string `json:"qrId"`
+		ItemID   uint   `json:"item_id"`
+		Quantity int    `json:"quantity"`
+		DueAt    string `json:"due_at,omitempty"` // RFC3339
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator && user.Status != models.Volunteer {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admin, moderator, or volunteer only",
+		})
+		return
+	}
+
+	var bodyData CheckoutBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	if bodyData.Quantity == 0 {
+		bodyData.Quantity = 1
+	}
+	if bodyData.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Quantity must be positive",
+		})
+		return
+	}
+
+	dueAt := time.Now().Add(defaultHardwareLoan)
+	if bodyData.DueAt != "" {
+		parsed, err := time.Parse(time.RFC3339, bodyData.DueAt)
+		if err != nil || parsed.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid due_at, expected a future RFC3339 time",
+			})
+			return
+		}
+		dueAt = parsed
+	}
+
+	// Get the user borrowing hardware
+	borrower := FindUserByQRCode(bodyData.QRid)
+	if borrower.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if borrower.Status != models.Attended && borrower.Status != models.Admin && borrower.Status != models.Moderator && borrower.Status != models.Volunteer {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "User status is not valid for borrowing hardware",
+		})
+		return
+	}
+
+	checkout := models.HardwareCheckout{
+		HardwareItemId: bodyData.ItemID,
+		DiscordId:      borrower.DiscordId,
+		Quantity:       bodyData.Quantity,
+		DueAt:          dueAt,
+		CheckedOutBy:   user.DiscordId,
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the item so concurrent checkouts cannot over allocate it
+		var item models.HardwareItem
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, bodyData.ItemID).Error; err != nil {
+			return err
+		}
+
+		checkedOut, err := checkedOutQuantity(tx, item.ID)
+		if err != nil {
+			return err
+		}
+		if item.Quantity-checkedOut < bodyData.Quantity {
+			return errHardwareUnavailable
+		}
+
+		checkout.HardwareItem = item
+		return tx.Omit("HardwareItem").Create(&checkout).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Hardware item not found",
+		})
+		return
+	} else if errors.Is(err, errHardwareUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Not enough of this item is available",
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to check out hardware",
+		})
+		fmt.Println("HardwareCheckout - ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"checkout": toCheckoutResponse(checkout),
+	})
+}
+
+func HardwareReturn(c *gin.Context) {
+
+	type ReturnBody struct {
+		CheckoutID uint `json:"checkout_id"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator && user.Status != models.Volunteer {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admin, moderator, or volunteer only",
+		})
+		return
+	}
+
+	var bodyData ReturnBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	var checkout models.HardwareCheckout
+	initializers.DB.Preload("HardwareItem").First(&checkout, bodyData.CheckoutID)
+
+	if checkout.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Checkout not found",
+		})
+		return
+	}
+
+	if checkout.ReturnedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Hardware has already been returned",
+		})
+		return
+	}
+
+	now := time.Now()
+	checkout.ReturnedAt = &now
+	checkout.ReturnedTo = user.DiscordId
+
+	// Only return the checkout if it is still out, so concurrent returns cannot both succeed
+	result := initializers.DB.Model(&models.HardwareCheckout{}).
+		Where("id = ? AND returned_at IS NULL", checkout.ID).
+		Updates(map[string]interface{}{
+			"returned_at": now,
+			"returned_to": user.DiscordId,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to return hardware",
+		})
+		fmt.Println("HardwareReturn - ", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Hardware has already been returned",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"checkout": toCheckoutResponse(checkout),
+	})
+}
+
+// HardwareOutstanding lists unreturned hardware for the user with the given qrId,
+// or for every user if no qrId is given.
+func HardwareOutstanding(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator && user.Status != models.Volunteer {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admin, moderator, or volunteer only",
+		})
+		return
+	}
+
+	query := initializers.DB.Preload("HardwareItem").Where("returned_at IS NULL")
+
+	if qrCode := c.DefaultQuery("qrId", ""); qrCode != "" {
+		borrower := FindUserByQRCode(qrCode)
+		if borrower.ID == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		query = query.Where("discord_id = ?", borrower.DiscordId)
+	}
+
+	var checkouts []models.HardwareCheckout
+	if err := query.Order("due_at").Find(&checkouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch outstanding hardware",
+		})
+		return
+	}
+
+	checkoutsResponse := []gin.H{}
+	for _, checkout := range checkouts {
+		checkoutsResponse = append(checkoutsResponse, toCheckoutResponse(checkout))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"checkouts": checkoutsResponse,
+	})
+}
@@ -0,0 +1,417 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/discord"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"github.com/utmmcss/deerhacks-backend/storage"
+)
+
+// Statuses whose resumes can go in a resume book, the hackers who are attending
+var resumeBookStatuses = []models.Status{models.Accepted, models.Attended}
+
+// How often a running export records that it is still running, and how long without one before it
+// counts as interrupted
+const (
+	resumeBookHeartbeat  = 1 * time.Minute
+	resumeBookStaleAfter = 5 * time.Minute
+)
+
+// Runs of characters replaced with dashes when building file names in the zip
+var resumeBookFilenamePattern = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// A consenting hacker included in a resume book
+type resumeBookEntry struct {
+	DiscordId      string
+	FirstName      string
+	LastName       string
+	School         string
+	Program        string
+	GraduationYear int
+	Github         string
+	Linkedin       string
+	ResumeKey      string
+}
+
+func constructResumeBookKey(bookId uint) (string, error) {
+	key, err := constructResumeKey("resume-books")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(key, persistentFileName) + fmt.Sprintf("resume-book-%d.zip", bookId), nil
+}
+
+// Gives every resume in the zip a consistent name, Last_First_<discord id>.pdf
+func resumeBookFilename(entry resumeBookEntry) string {
+	parts := []string{}
+	for _, name := range []string{entry.LastName, entry.FirstName} {
+		if cleaned := strings.Trim(resumeBookFilenamePattern.ReplaceAllString(name, "-"), "-"); cleaned != "" {
+			parts = append(parts, cleaned)
+		}
+	}
+	parts = append(parts, entry.DiscordId)
+	return strings.Join(parts, "_") + ".pdf"
+}
+
+// Finds the consenting hackers matching the resume book's filters, skipping resumes flagged as infected
+func findResumeBookEntries(book *models.ResumeBook) ([]resumeBookEntry, error) {
+	statuses := []models.Status{}
+	for _, status := range strings.Split(book.Statuses, ",") {
+		statuses = append(statuses, models.Status(status))
+	}
+
+	query := consentingApplicationQuery(statuses).
+		Select("users.discord_id, users.first_name, users.last_name, applications.school, applications.program, COALESCE(applications.graduation_year, 0) AS graduation_year, applications.github, applications.linkedin, applications.resume_key").
+		Where("applications.resume_hash <> ''").
+		Where("applications.resume_scan_status IS NULL OR applications.resume_scan_status <> ?", helpers.ResumeScanInfected).
+		Order("users.last_name, users.first_name")
+
+	if book.Program != "" {
+		query = query.Where("applications.program ILIKE ?", "%"+book.Program+"%")
+	}
+	if book.GraduationYear != 0 {
+		query = query.Where("applications.graduation_year = ?", book.GraduationYear)
+	}
+
+	var entries []resumeBookEntry
+	err := query.Scan(&entries).Error
+	return entries, err
+}
+
+// Writes the resumes and a manifest.csv describing them into a zip file, returning how many resumes
+// were included and how many could not be read from storage
+func writeResumeBook(file io.Writer, store storage.ResumeStore, entries []resumeBookEntry) (int, int, error) {
+	archive := zip.NewWriter(file)
+
+	manifest := [][]string{{"file", "first_name", "last_name", "school", "program", "graduation_year", "github", "linkedin"}}
+	skipped := 0
+
+	for _, entry := range entries {
+		key, err := currentResumeKey(entry.DiscordId, entry.ResumeKey)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		resume, err := store.Get(key)
+		if err != nil {
+			fmt.Println("BuildResumeBook - Failed to read resume of user with discord_id", entry.DiscordId, ":", err)
+			skipped++
+			continue
+		}
+
+		filename := resumeBookFilename(entry)
+		writer, err := archive.Create(filename)
+		if err == nil {
+			_, err = io.Copy(writer, resume)
+		}
+		resume.Close()
+		if err != nil {
+			return 0, 0, fmt.Errorf("error adding %s to zip: %w", filename, err)
+		}
+
+		graduationYear := ""
+		if entry.GraduationYear != 0 {
+			graduationYear = strconv.Itoa(entry.GraduationYear)
+		}
+		manifest = append(manifest, []string{filename, entry.FirstName, entry.LastName, entry.School, entry.Program, graduationYear, entry.Github, entry.Linkedin})
+	}
+
+	writer, err := archive.Create("manifest.csv")
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := csv.NewWriter(writer).WriteAll(manifest); err != nil {
+		return 0, 0, err
+	}
+
+	return len(manifest) - 1, skipped, archive.Close()
+}
+
+// Collects the resume book into a temporary zip and stores it
+func buildResumeBook(book *models.ResumeBook) error {
+	store, err := storage.Resumes()
+	if err != nil {
+		return fmt.Errorf("error opening resume storage: %w", err)
+	}
+
+	entries, err := findResumeBookEntries(book)
+	if err != nil {
+		return fmt.Errorf("error finding resumes: %w", err)
+	}
+
+	key, err := constructResumeBookKey(book.ID)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "resume-book-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	count, skipped, err := writeResumeBook(file, store, entries)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := store.Put(key, file, "application/zip"); err != nil {
+		return fmt.Errorf("error storing zip: %w", err)
+	}
+
+	completedAt := time.Now()
+	book.Key = key
+	book.ResumeCount = count
+	book.SkippedCount = skipped
+	book.CompletedAt = &completedAt
+	return nil
+}
+
+// Records that the export is still running until done is closed
+func beatResumeBook(bookId uint, done <-chan struct{}) {
+	ticker := time.NewTicker(resumeBookHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := initializers.DB.Model(&models.ResumeBook{}).Where("id = ?", bookId).Update("heartbeat_at", time.Now()).Error; err != nil {
+				fmt.Println("BuildResumeBook - Failed to record heartbeat: ", err)
+			}
+		}
+	}
+}
+
+// Runs a resume book export, recording the outcome on the resume book
+func runResumeBook(book models.ResumeBook) {
+	heartbeatAt := time.Now()
+	book.HeartbeatAt = &heartbeatAt
+	initializers.DB.Model(&book).Updates(map[string]interface{}{
+		"status":       models.ResumeBookRunning,
+		"heartbeat_at": heartbeatAt,
+	})
+
+	done := make(chan struct{})
+	go beatResumeBook(book.ID, done)
+	defer close(done)
+
+	if err := buildResumeBook(&book); err != nil {
+		fmt.Println("BuildResumeBook - ", err)
+		discord.NotifyStaffError(fmt.Sprintf("Resume book %d", book.ID), err)
+
+		message := err.Error()
+		if len(message) > 1000 {
+			message = message[:1000]
+		}
+		book.Status = models.ResumeBookFailed
+		book.Error = message
+	} else {
+		book.Status = models.ResumeBookComplete
+	}
+
+	if err := initializers.DB.Save(&book).Error; err != nil {
+		fmt.Println("BuildResumeBook - Failed to save resume book: ", err)
+	}
+}
+
+// FailInterruptedResumeBooks marks exports whose instance stopped running them, such as by restarting,
+// as failed so they can be started again. Exports other instances are still running keep their heartbeat
+// fresh and are left alone.
+func FailInterruptedResumeBooks() {
+	err := initializers.DB.Model(&models.ResumeBook{}).
+		Where("status IN ?", []models.ResumeBookStatus{models.ResumeBookPending, models.ResumeBookRunning}).
+		Where("heartbeat_at IS NULL OR heartbeat_at < ?", time.Now().Add(-resumeBookStaleAfter)).
+		Updates(map[string]interface{}{
+			"status": models.ResumeBookFailed,
+			"error":  "Interrupted by a server restart",
+		}).Error
+	if err != nil {
+		fmt.Println("FailInterruptedResumeBooks - ", err)
+	}
+}
+
+// FailInterruptedResumeBooksTask fails interrupted exports on an interval, catching those of instances
+// that stopped after this one started
+func FailInterruptedResumeBooksTask(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		<-ticker.C
+		FailInterruptedResumeBooks()
+	}
+}
+
+func resumeBookResponse(book *models.ResumeBook) gin.H {
+	response := gin.H{
+		"id":              book.ID,
+		"status":          book.Status,
+		"statuses":        strings.Split(book.Statuses, ","),
+		"program":         book.Program,
+		"graduation_year": book.GraduationYear,
+		"resume_count":    book.ResumeCount,
+		"skipped_count":   book.SkippedCount,
+		"error":           book.Error,
+		"requested_by":    book.RequestedBy,
+		"created_at":      book.CreatedAt.Format(time.RFC3339),
+	}
+	if book.CompletedAt != nil {
+		response["completed_at"] = book.CompletedAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// AdminResumeBookCreate starts exporting the resumes of consenting accepted or attended hackers,
+// optionally filtered by program and graduation year. Poll AdminResumeBookGet for the download link.
+func AdminResumeBookCreate(c *gin.Context) {
+
+	type ResumeBookBody struct {
+		Statuses       []models.Status `json:"statuses,omitempty"`
+		Program        string          `json:"program,omitempty"`
+		GraduationYear int             `json:"graduation_year,omitempty"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var bodyData ResumeBookBody
+	if err := c.ShouldBindJSON(&bodyData); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	if len(bodyData.Statuses) == 0 {
+		bodyData.Statuses = resumeBookStatuses
+	}
+
+	statuses := []string{}
+	for _, status := range bodyData.Statuses {
+		if status != models.Accepted && status != models.Attended {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Resume books can only include accepted or attended users",
+			})
+			return
+		}
+		statuses = append(statuses, string(status))
+	}
+
+	createdAt := time.Now()
+	book := models.ResumeBook{
+		RequestedBy:    user.DiscordId,
+		Statuses:       strings.Join(statuses, ","),
+		Program:        strings.TrimSpace(bodyData.Program),
+		GraduationYear: bodyData.GraduationYear,
+		HeartbeatAt:    &createdAt,
+	}
+	if err := initializers.DB.Create(&book).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create resume book",
+		})
+		fmt.Println("AdminResumeBookCreate - ", err)
+		return
+	}
+
+	go runResumeBook(book)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"id":     book.ID,
+		"status": book.Status,
+	})
+}
+
+// AdminResumeBookGet returns a resume book export by id, or every export when no id is given.
+// Completed exports include a download link.
+func AdminResumeBookGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	if c.Query("id") == "" {
+		var books []models.ResumeBook
+		if err := initializers.DB.Order("created_at DESC").Find(&books).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch resume books",
+			})
+			fmt.Println("AdminResumeBookGet - ", err)
+			return
+		}
+
+		booksResponse := []gin.H{}
+		for i := range books {
+			booksResponse = append(booksResponse, resumeBookResponse(&books[i]))
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"resume_books": booksResponse,
+		})
+		return
+	}
+
+	var book models.ResumeBook
+	initializers.DB.First(&book, "id = ?", c.Query("id"))
+	if book.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Resume book not found",
+		})
+		return
+	}
+
+	response := resumeBookResponse(&book)
+
+	// Download links are only given for a single resume book, to avoid presigning every past export
+	if book.Status == models.ResumeBookComplete {
+		store, err := storage.Resumes()
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			fmt.Println("AdminResumeBookGet - Error in opening resume storage: ", err)
+			return
+		}
+
+		link, err := store.Presign(book.Key, fmt.Sprintf("resume-book-%d.zip", book.ID), resumeLinkExpiry)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			fmt.Println("AdminResumeBookGet - Error in getting presigned url: ", err)
+			return
+		}
+
+		response["download_link"] = link
+		response["download_expiry"] = time.Now().Add(resumeLinkExpiry).Format(time.RFC3339)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
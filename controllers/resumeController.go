@@ -4,29 +4,33 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/discord"
 	"github.com/utmmcss/deerhacks-backend/helpers"
 	"github.com/utmmcss/deerhacks-backend/initializers"
 	"github.com/utmmcss/deerhacks-backend/models"
+	"github.com/utmmcss/deerhacks-backend/storage"
 	"gorm.io/gorm"
 )
 
-// rename file to specific name
-// ensures files are overwritten in S3
+// Resumes uploaded before versioning, and pending direct uploads, are stored under this name
 const persistentFileName = "Resume.pdf"
 
-func constructS3Key(discordId string) (string, error) {
+// How long presigned resume links stay valid. Links given to clients go through ResumeRedirect, which
+// presigns a new one every time, so these only need to last until the redirect is followed.
+const resumeLinkExpiry = 15 * time.Minute
+
+func constructResumeKey(discordId string) (string, error) {
 	appEnv := os.Getenv("APP_ENV")
 
 	folderName := ""
@@ -35,79 +39,148 @@ func constructS3Key(discordId string) (string, error) {
 	} else if appEnv == "production" {
 		folderName = "prod"
 	} else {
-		return "", fmt.Errorf("constructS3Key - environment not defined for current appEnv")
+		return "", fmt.Errorf("constructResumeKey - environment not defined for current appEnv")
 	}
 
 	filepath := folderName + "/" + discordId + "/" + persistentFileName
 	return filepath, nil
 }
 
-func getPresignedURL(svc *s3.S3, filepath string, filename string) (string, error) {
-	// Get the file and return it
-	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
-		Bucket:                     aws.String("dhapplications"),
-		Key:                        aws.String(filepath),
-		ResponseContentDisposition: aws.String(fmt.Sprintf("inline; filename=\"%s\"", filename)),
-		ResponseContentType:        aws.String("application/pdf"),
-	})
+// Every upload is stored as a new version, named by upload time and hash, so earlier resumes are kept
+func constructResumeVersionKey(discordId string, hash string) (string, error) {
+	key, err := constructResumeKey(discordId)
+	if err != nil {
+		return "", err
+	}
+	if len(hash) > 16 {
+		hash = hash[:16]
+	}
+	return strings.TrimSuffix(key, persistentFileName) + fmt.Sprintf("versions/%d-%s.pdf", time.Now().UnixNano(), hash), nil
+}
 
-	// URL is valid for 7 hours
-	urlStr, err := req.Presign(7 * time.Hour)
+// Key of an application's current resume, given its ResumeKey. Resumes uploaded before versioning
+// have no ResumeKey and are at the original key.
+func currentResumeKey(discordId string, resumeKey string) (string, error) {
+	if resumeKey != "" {
+		return resumeKey, nil
+	}
+	return constructResumeKey(discordId)
+}
 
-	if err != nil {
-		return "", fmt.Errorf("getPresignedURL -", err)
+// Records an uploaded resume version. The first upload after versioning also records the original
+// resume, so it stays in the history.
+func saveResumeVersion(tx *gorm.DB, application *models.Application, version *models.ResumeVersion) error {
+	if application.ResumeKey == "" && application.ResumeHash != "" {
+		originalKey, err := constructResumeKey(application.DiscordId)
+		if err != nil {
+			return err
+		}
+		original := models.ResumeVersion{
+			DiscordId: application.DiscordId,
+			Key:       originalKey,
+			Hash:      application.ResumeHash,
+			Filename:  application.ResumeFilename,
+		}
+		original.CreatedAt = application.UpdatedAt
+		if err := tx.Create(&original).Error; err != nil {
+			return err
+		}
 	}
+	return tx.Create(version).Error
+}
 
-	return urlStr, nil
+// Direct uploads go to a pending key and only replace the resume once confirmed
+func constructPendingResumeKey(discordId string) (string, error) {
+	key, err := constructResumeKey(discordId)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(key, persistentFileName) + "pending/" + persistentFileName, nil
+}
 
+// Stable link to an application's resume, which redirects to a freshly presigned URL. Links are
+// absolute when BACKEND_URL is set.
+func resumeURL(discordId string) string {
+	return strings.TrimSuffix(os.Getenv("BACKEND_URL"), "/") + "/resume/" + url.PathEscape(discordId)
 }
 
-func GetResumeDetails(user *models.User, application *models.Application) (string, string, error) {
-	// If the application or resume link does not exist return empty response
-	if application.ID == 0 || application.ResumeLink == "" {
-		return "", "", nil
+// GetResumeDetails returns the filename of an application's resume and a stable link to it, or empty
+// strings if there is no resume
+func GetResumeDetails(application *models.Application) (string, string) {
+	if application.ID == 0 || application.ResumeHash == "" {
+		return "", ""
 	}
+	return application.ResumeFilename, resumeURL(application.DiscordId)
+}
 
-	// Check expiry of resume link
-	passed, err := helpers.HasTimePassed(application.ResumeExpiry)
-	if err != nil {
-		return "", "", fmt.Errorf("error checking resume expiry: %w", err)
+// ResumeRedirect redirects to a freshly presigned link to a hacker's resume. Hackers can open their own
+// resume, and admins and moderators anyone's.
+func ResumeRedirect(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	discordId := c.Param("discord_id")
+	if discordId != user.DiscordId && user.Status != models.Admin && user.Status != models.Moderator {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
 	}
-	// If expiry has not arrived yet, return link and filename
-	if !passed {
-		return application.ResumeFilename, application.ResumeLink, nil
+
+	var application models.Application
+	initializers.DB.First(&application, "discord_id = ?", discordId)
+	if application.ID == 0 || application.ResumeHash == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
 	}
-	// If link is expired generate new presigned URL (check app_env)
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-2"),
-	})
+
+	store, err := storage.Resumes()
 	if err != nil {
-		return "", "", fmt.Errorf("error creating AWS session: %w", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ResumeRedirect - Error in opening resume storage: ", err)
+		return
 	}
 
-	svc := s3.New(sess)
-
-	// filePath, err := constructS3Key(user.DiscordId)
-	filePath, err := constructS3Key(strings.Split(application.ResumeLink, "/")[4])
+	key, err := currentResumeKey(application.DiscordId, application.ResumeKey)
 	if err != nil {
-		return "", "", fmt.Errorf("error constructing S3 key: %w", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ResumeRedirect - ", err)
+		return
 	}
 
-	presignedURL, err := getPresignedURL(svc, filePath, application.ResumeFilename)
+	presignedURL, err := store.Presign(key, application.ResumeFilename, resumeLinkExpiry)
 	if err != nil {
-		return "", "", fmt.Errorf("error getting presigned URL: %w", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ResumeRedirect - Error in getting presigned url: ", err)
+		return
 	}
 
-	// Set ResumeLink to new url and update Expiry
-	application.ResumeLink = presignedURL
-	application.ResumeExpiry = time.Now().Add(7 * time.Hour).Format(time.RFC3339)
+	// The presigned link expires, so it must not be cached in place of the stable one
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, presignedURL)
+}
+
+// ServeResumeFile serves resumes from local storage for the signed links it hands out.
+// Resumes in S3 are linked to directly, so this route is only used in development.
+func ServeResumeFile(c *gin.Context) {
 
-	result := initializers.DB.Save(application)
-	if result.Error != nil {
-		return "", "", fmt.Errorf("error saving application to database: %w", result.Error)
+	store, err := storage.Resumes()
+	localStore, ok := store.(*storage.LocalStore)
+	if err != nil || !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
 	}
-	// Return link and filename
-	return application.ResumeFilename, presignedURL, nil
+
+	filename := c.Query("filename")
+	path, err := localStore.Verify(c.Query("key"), filename, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	contentType, disposition := storage.ResponseHeaders(filename)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", disposition)
+	c.File(path)
 }
 
 func GetResume(c *gin.Context) {
@@ -118,13 +191,7 @@ func GetResume(c *gin.Context) {
 	var application models.Application
 	initializers.DB.First(&application, "discord_id = ?", user.DiscordId)
 
-	filename, link, err := GetResumeDetails(&user, &application)
-
-	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
-		fmt.Println("GetResume - ", err)
-		return
-	}
+	filename, link := GetResumeDetails(&application)
 
 	if filename == "" || link == "" {
 		c.JSON(http.StatusOK, gin.H{})
@@ -133,38 +200,57 @@ func GetResume(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"resume_file_name":    application.ResumeFilename,
-		"resume_link":         application.ResumeLink,
+		"resume_file_name":    filename,
+		"resume_link":         link,
 		"resume_update_count": user.ResumeUpdateCount,
 	})
 }
 
-func UpdateResume(c *gin.Context) {
+var (
+	errResumeTooLarge = &helpers.ResumeValidationError{Code: helpers.ResumeFileTooLarge, Message: "Resume must be at most 2 MB with a filename under 100 characters"}
+	errResumeFileType = &helpers.ResumeValidationError{Code: helpers.ResumeFileTypeError, Message: "Resume must be a PDF"}
+	errResumeMalware  = &helpers.ResumeValidationError{Code: helpers.ResumeMalware, Message: "Resume was flagged by the malware scanner"}
+	errResumeNoScan   = &helpers.ResumeValidationError{Code: helpers.ResumeScanNotAvailable, Message: "Resumes cannot be checked right now, please try again later"}
+)
 
-	userObj, _ := c.Get("user")
-	user := userObj.(models.User)
+// Rejects a resume upload with the validation error code, so the client can explain what was wrong
+func abortInvalidResume(c *gin.Context, status int, err *helpers.ResumeValidationError) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": err.Message,
+		"code":  err.Code,
+	})
+}
 
-	// If user is not registering, return error
-	// Admins can update resumes at any time
-	if (user.Status != models.Registering) && user.Status != models.Admin {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "User is not allowed to update resume at this time",
-		})
-		return
-	}
+// Scans a resume for malware, responding and returning false if it is infected, or if the scanner is
+// unavailable and RESUME_SCANNER_POLICY fails closed
+func scanUploadedResume(c *gin.Context, user *models.User, fileData []byte, funcName string) (helpers.ResumeScanResult, bool) {
+	result, err := helpers.ScanResume(fileData)
+	if err != nil {
+		fmt.Println(funcName, "- Failed to scan resume:", err)
+		discord.NotifyStaffError(funcName, err)
 
-	// Ensure registration open
-	isOpen, err := helpers.IsRegistrationOpen()
+		if !helpers.ScannerFailsOpen() {
+			abortInvalidResume(c, http.StatusServiceUnavailable, errResumeNoScan)
+			return result, false
+		}
+		result.Status = helpers.ResumeScanUnavailable
+	}
 
-	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
-		fmt.Println("UpdateResume - Failed to check registration status:", err)
-		return
+	if result.Status == helpers.ResumeScanInfected {
+		abortInvalidResume(c, http.StatusBadRequest, errResumeMalware)
+		fmt.Println(funcName, "- Infected resume uploaded by user with discord_id", user.DiscordId, ":", result.Signature)
+		return result, false
 	}
 
-	if !isOpen {
-		c.AbortWithStatus(http.StatusForbidden)
-		fmt.Println("UpdateResume - Registration is closed")
+	return result, true
+}
+
+func UpdateResume(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if !canUpdateResume(c, &user, "UpdateResume") {
 		return
 	}
 
@@ -182,22 +268,18 @@ func UpdateResume(c *gin.Context) {
 
 	// ensure size is less than 2 MB and limit file length
 	if fileSizeMB > 2 || len(filename) > 100 {
-		c.AbortWithStatus(413)
+		abortInvalidResume(c, http.StatusRequestEntityTooLarge, errResumeTooLarge)
 		fmt.Println("UpdateResume - file/filename too large")
 		return
 	}
 
 	// ensure file is a pdf
 	if filepath.Ext(filename) != ".pdf" {
-		c.AbortWithStatus(415)
+		abortInvalidResume(c, http.StatusUnsupportedMediaType, errResumeFileType)
 		fmt.Println("UpdateResume - File not supported")
 		return
 	}
 
-	// Force file name to be a certain name
-	// Ensures files are overwritten in S3
-	filename = "Resume.pdf"
-
 	var application models.Application
 	initializers.DB.First(&application, "discord_id = ?", user.DiscordId)
 
@@ -241,19 +323,13 @@ func UpdateResume(c *gin.Context) {
 		return
 	}
 
-	// Create s3 session
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-2"),
-	})
-
+	store, err := storage.Resumes()
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
-		fmt.Println("UpdateResume - Error in creating AWS Session: ", err)
+		fmt.Println("UpdateResume - Error in opening resume storage: ", err)
 		return
 	}
 
-	svc := s3.New(sess)
-
 	// Read File data
 	fileData, err := io.ReadAll(uploadedFile)
 
@@ -263,67 +339,390 @@ func UpdateResume(c *gin.Context) {
 		return
 	}
 
-	// a (weak) check to see if uploaded file contains JavaScript
-	if bytes.Contains(fileData, []byte("/JS")) {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println("UpdateResume - Upload of resume with JavaScript attempted by user with discord_id", user.DiscordId)
+	if err := helpers.ValidateResumePDF(fileData); err != nil {
+		abortInvalidResume(c, http.StatusBadRequest, err)
+		fmt.Println("UpdateResume - Invalid resume uploaded by user with discord_id", user.DiscordId, ":", err)
 		return
 	}
 
-	s3key, err := constructS3Key(user.DiscordId)
-	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
-		fmt.Println("GetResume - environment not defined for current appEnv", err)
+	scan, ok := scanUploadedResume(c, &user, fileData, "UpdateResume")
+	if !ok {
 		return
 	}
 
-	// Upload the file
-	_, err = svc.PutObject(&s3.PutObjectInput{
-		Bucket: aws.String("dhapplications"),
-		Key:    aws.String(s3key),
-		Body:   bytes.NewReader(fileData),
-	})
+	resumeText := extractUploadedResumeText(fileData, "UpdateResume")
+
+	key, err := constructResumeVersionKey(user.DiscordId, computedHash)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
-		fmt.Println("UpdateResume - Failed to upload file: ", err)
+		fmt.Println("UpdateResume - ", err)
 		return
 	}
 
-	// Get presigned url
-	presigned_url, err := getPresignedURL(svc, s3key, file.Filename)
-
+	// Upload the file
+	err = store.Put(key, bytes.NewReader(fileData), "application/pdf")
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
-		fmt.Println("UpdateResume - Error in getting presigned url: ", err)
+		fmt.Println("UpdateResume - Failed to upload file: ", err)
 		return
 	}
 
-	application.ResumeLink = presigned_url
-	application.ResumeExpiry = time.Now().Add(7 * time.Hour).Format(time.RFC3339)
 	application.ResumeHash = computedHash
 	application.ResumeFilename = file.Filename
-	user.ResumeUpdateCount += 1
+	application.ResumeScanStatus = scan.Status
+	application.ResumeScanSignature = scan.Signature
+	application.ResumeScannedAt = scan.ScannedAt
+	quotaPolicy := helpers.GetResumeQuotaPolicy()
+	version := models.ResumeVersion{
+		DiscordId: user.DiscordId,
+		Key:       key,
+		Hash:      computedHash,
+		Filename:  file.Filename,
+		Size:      int64(len(fileData)),
+	}
 	result := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if quotaErr := claimResumeUpload(tx, &user, quotaPolicy, time.Now()); quotaErr != nil {
+			return quotaErr
+		}
+		if versionErr := saveResumeVersion(tx, &application, &version); versionErr != nil {
+			return versionErr
+		}
+		application.ResumeKey = key
 		if appErr := tx.Save(&application).Error; appErr != nil {
 			return appErr
 		}
-		if userErr := tx.Save(&user).Error; userErr != nil {
-			return userErr
+		if textErr := saveResumeText(tx, application.ID, resumeText); textErr != nil {
+			return textErr
 		}
 		return nil
 	})
+	if errors.Is(result, errResumeQuotaExceeded) {
+		store.Delete(key)
+		abortResumeQuotaExceeded(c, &user, quotaPolicy)
+		fmt.Println("UpdateResume - User", user.DiscordId, "has no resume uploads remaining")
+		return
+	}
 	if result != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		fmt.Println("UpdateResume - Error in saving Resume Data to Database: ", result)
 		return
 	}
 
+	setResumeQuotaHeaders(c, user, quotaPolicy, "UpdateResume")
+
 	// Return link and filename
 
 	c.JSON(http.StatusOK, gin.H{
 		"resume_file_name":    file.Filename,
-		"resume_link":         application.ResumeLink,
+		"resume_link":         resumeURL(user.DiscordId),
+		"resume_update_count": user.ResumeUpdateCount,
+	})
+
+}
+
+// Checks shared by every way of updating a resume, responding and returning false if the user cannot update it now
+func canUpdateResume(c *gin.Context, user *models.User, funcName string) bool {
+	// If user is not registering, return error
+	// Admins can update resumes at any time
+	if (user.Status != models.Registering) && user.Status != models.Admin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "User is not allowed to update resume at this time",
+		})
+		return false
+	}
+
+	// Ensure registration open
+	isOpen, err := helpers.IsRegistrationOpen()
+
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println(funcName, "- Failed to check registration status:", err)
+		return false
+	}
+
+	if !isOpen {
+		c.AbortWithStatus(http.StatusForbidden)
+		fmt.Println(funcName, "- Registration is closed")
+		return false
+	}
+
+	return true
+}
+
+// Largest resume that can be uploaded directly to storage
+const maxResumeBytes = 2 * 1024 * 1024
+
+// How long a presigned upload URL stays valid
+const resumeUploadExpiry = 15 * time.Minute
+
+// ResumeUploadURL returns a presigned URL the client uploads their resume to directly,
+// constrained to the size and content type given. The upload is applied by ConfirmResumeUpload.
+func ResumeUploadURL(c *gin.Context) {
+
+	type UploadBody struct {
+		Filename    string `json:"filename"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"content_type"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if !canUpdateResume(c, &user, "ResumeUploadURL") {
+		return
+	}
+
+	var bodyData UploadBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	// ensure size is less than 2 MB and limit file length
+	if bodyData.Size <= 0 || bodyData.Size > maxResumeBytes || len(bodyData.Filename) > 100 {
+		abortInvalidResume(c, http.StatusRequestEntityTooLarge, errResumeTooLarge)
+		fmt.Println("ResumeUploadURL - file/filename too large")
+		return
+	}
+
+	// ensure file is a pdf
+	if filepath.Ext(bodyData.Filename) != ".pdf" || bodyData.ContentType != "application/pdf" {
+		abortInvalidResume(c, http.StatusUnsupportedMediaType, errResumeFileType)
+		fmt.Println("ResumeUploadURL - File not supported")
+		return
+	}
+
+	store, err := storage.Resumes()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ResumeUploadURL - Error in opening resume storage: ", err)
+		return
+	}
+
+	key, err := constructPendingResumeKey(user.DiscordId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ResumeUploadURL - ", err)
+		return
+	}
+
+	upload, err := store.PresignPut(key, bodyData.ContentType, bodyData.Size, resumeUploadExpiry)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ResumeUploadURL - Error in getting presigned upload url: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"upload":     upload,
+		"expires_at": time.Now().Add(resumeUploadExpiry).Format(time.RFC3339),
+	})
+}
+
+// ConfirmResumeUpload checks the resume uploaded through ResumeUploadURL and makes it the user's resume
+func ConfirmResumeUpload(c *gin.Context) {
+
+	type ConfirmBody struct {
+		Filename string `json:"filename"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if !canUpdateResume(c, &user, "ConfirmResumeUpload") {
+		return
+	}
+
+	var bodyData ConfirmBody
+	if err := c.Bind(&bodyData); err != nil || len(bodyData.Filename) > 100 || filepath.Ext(bodyData.Filename) != ".pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	store, err := storage.Resumes()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - Error in opening resume storage: ", err)
+		return
+	}
+
+	pendingKey, err := constructPendingResumeKey(user.DiscordId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - ", err)
+		return
+	}
+
+	// Verify the object was uploaded and is within the size limit
+	info, err := store.Stat(pendingKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "No uploaded resume found",
+		})
+		return
+	}
+
+	// Always clear the pending upload, so it cannot be confirmed twice
+	defer store.Delete(pendingKey)
+
+	if info.Size > maxResumeBytes {
+		abortInvalidResume(c, http.StatusRequestEntityTooLarge, errResumeTooLarge)
+		fmt.Println("ConfirmResumeUpload - file too large")
+		return
+	}
+
+	object, err := store.Get(pendingKey)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - Error in reading uploaded file: ", err)
+		return
+	}
+	fileData, err := io.ReadAll(io.LimitReader(object, maxResumeBytes+1))
+	object.Close()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - Error in reading uploaded file: ", err)
+		return
+	}
+	if len(fileData) > maxResumeBytes {
+		abortInvalidResume(c, http.StatusRequestEntityTooLarge, errResumeTooLarge)
+		fmt.Println("ConfirmResumeUpload - file too large")
+		return
+	}
+
+	if err := helpers.ValidateResumePDF(fileData); err != nil {
+		abortInvalidResume(c, http.StatusBadRequest, err)
+		fmt.Println("ConfirmResumeUpload - Invalid resume uploaded by user with discord_id", user.DiscordId, ":", err)
+		return
+	}
+
+	scan, ok := scanUploadedResume(c, &user, fileData, "ConfirmResumeUpload")
+	if !ok {
+		return
+	}
+
+	resumeText := extractUploadedResumeText(fileData, "ConfirmResumeUpload")
+
+	// compute sha256 hash of file
+	hash := sha256.Sum256(fileData)
+	computedHash := hex.EncodeToString(hash[:])
+
+	var application models.Application
+	initializers.DB.First(&application, "discord_id = ?", user.DiscordId)
+
+	if application.ID == 0 {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - Application does not exist")
+		return
+	}
+
+	// If the resume is unchanged, Get Resume like normal
+	if computedHash == application.ResumeHash {
+		GetResume(c)
+		return
+	}
+
+	key, err := constructResumeVersionKey(user.DiscordId, computedHash)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - ", err)
+		return
+	}
+
+	if err := store.Put(key, bytes.NewReader(fileData), "application/pdf"); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - Failed to store file: ", err)
+		return
+	}
+
+	quotaPolicy := helpers.GetResumeQuotaPolicy()
+	version := models.ResumeVersion{
+		DiscordId: user.DiscordId,
+		Key:       key,
+		Hash:      computedHash,
+		Filename:  bodyData.Filename,
+		Size:      int64(len(fileData)),
+	}
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimResumeUpload(tx, &user, quotaPolicy, time.Now()); err != nil {
+			return err
+		}
+		if err := saveResumeVersion(tx, &application, &version); err != nil {
+			return err
+		}
+		if err := tx.Model(&application).Updates(map[string]interface{}{
+			"resume_key":            key,
+			"resume_hash":           computedHash,
+			"resume_filename":       bodyData.Filename,
+			"resume_scan_status":    scan.Status,
+			"resume_scan_signature": scan.Signature,
+			"resume_scanned_at":     scan.ScannedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return saveResumeText(tx, application.ID, resumeText)
+	})
+	if errors.Is(err, errResumeQuotaExceeded) {
+		store.Delete(key)
+		abortResumeQuotaExceeded(c, &user, quotaPolicy)
+		fmt.Println("ConfirmResumeUpload - User", user.DiscordId, "has no resume uploads remaining")
+		return
+	}
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("ConfirmResumeUpload - Error in saving Resume Data to Database: ", err)
+		return
+	}
+
+	setResumeQuotaHeaders(c, user, quotaPolicy, "ConfirmResumeUpload")
+
+	c.JSON(http.StatusOK, gin.H{
+		"resume_file_name":    bodyData.Filename,
+		"resume_link":         resumeURL(user.DiscordId),
 		"resume_update_count": user.ResumeUpdateCount,
 	})
+}
+
+// UploadResumeFile accepts direct uploads to local storage for the URLs from ResumeUploadURL.
+// S3 takes these uploads itself, so this route is only used in development.
+func UploadResumeFile(c *gin.Context) {
+
+	store, err := storage.Resumes()
+	localStore, ok := store.(*storage.LocalStore)
+	if err != nil || !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	key := c.Query("key")
+	contentType := c.Query("content_type")
+	size, err := localStore.VerifyPut(key, contentType, c.Query("size"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	// The upload must match the size and type it was signed for
+	if c.Request.ContentLength != size || c.ContentType() != contentType {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, size+1))
+	if err != nil || int64(len(data)) != size {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if err := localStore.Put(key, bytes.NewReader(data), contentType); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("UploadResumeFile - Failed to store file: ", err)
+		return
+	}
 
+	c.Status(http.StatusOK)
 }
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errResumeQuotaExceeded = errors.New("resume upload quota exceeded")
+
+// Counts an upload against the user's quota with a conditional update, so concurrent uploads cannot both
+// take the last one. Returns errResumeQuotaExceeded if no upload is left, otherwise reloads the user's
+// quota columns.
+func claimResumeUpload(tx *gorm.DB, user *models.User, policy helpers.ResumeQuotaPolicy, now time.Time) error {
+	// Lock the user first, so the window count below sees every upload committed before this one
+	var locked models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Take(&locked, user.ID).Error; err != nil {
+		return err
+	}
+
+	// Every upload is saved as a resume version, so the versions created within the window are its uploads
+	windowUploads := tx.Model(&models.ResumeVersion{}).
+		Select("COUNT(*)").
+		Where("discord_id = ? AND created_at > ?", user.DiscordId, now.Add(-policy.Window))
+
+	result := tx.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Where("resume_update_count < ? + resume_grant_count", policy.Lifetime).
+		Where("(?) < ?", windowUploads, policy.WindowUploads).
+		Update("resume_update_count", gorm.Expr("resume_update_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errResumeQuotaExceeded
+	}
+
+	var claimed models.User
+	if err := tx.Select("resume_update_count", "resume_grant_count").Take(&claimed, user.ID).Error; err != nil {
+		return err
+	}
+	user.ResumeUpdateCount = claimed.ResumeUpdateCount
+	user.ResumeGrantCount = claimed.ResumeGrantCount
+	return nil
+}
+
+// Returns what is left of the user's quota now, counting their uploads within the window
+func currentResumeQuota(user models.User, policy helpers.ResumeQuotaPolicy) (helpers.ResumeQuota, error) {
+	now := time.Now()
+	recentUploads, err := policy.RecentUploads(initializers.DB, user.DiscordId, now)
+	if err != nil {
+		return helpers.ResumeQuota{}, err
+	}
+	return policy.QuotaFor(user, recentUploads, now), nil
+}
+
+// Sets the quota headers on a successful upload
+func setResumeQuotaHeaders(c *gin.Context, user models.User, policy helpers.ResumeQuotaPolicy, funcName string) {
+	quota, err := currentResumeQuota(user, policy)
+	if err != nil {
+		fmt.Println(funcName, "- Failed to find recent resume uploads: ", err)
+		return
+	}
+	for name, value := range quota.Headers() {
+		c.Header(name, value)
+	}
+}
+
+// Responds with the user's current quota when an upload lost the race for their last one
+func abortResumeQuotaExceeded(c *gin.Context, user *models.User, policy helpers.ResumeQuotaPolicy) {
+	var current models.User
+	initializers.DB.First(&current, user.ID)
+
+	quota, err := currentResumeQuota(current, policy)
+	if err != nil {
+		fmt.Println("abortResumeQuotaExceeded - Failed to find recent resume uploads: ", err)
+	}
+	for name, value := range quota.Headers() {
+		c.Header(name, value)
+	}
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":           quota.ExceededMessage(),
+		"remaining_quota": quota.Remaining,
+	})
+}
+
+// AdminResumeQuotaGrant gives a user extra resume uploads beyond the lifetime cap. The uploads are
+// still limited by the quota window.
+func AdminResumeQuotaGrant(c *gin.Context) {
+
+	type GrantBody struct {
+		DiscordId string `json:"discord_id"`
+		Uploads   int    `json:"uploads"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var bodyData GrantBody
+	if err := c.Bind(&bodyData); err != nil || bodyData.DiscordId == "" || bodyData.Uploads < 1 || bodyData.Uploads > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	result := initializers.DB.Model(&models.User{}).
+		Where("discord_id = ?", bodyData.DiscordId).
+		Update("resume_grant_count", gorm.Expr("resume_grant_count + ?", bodyData.Uploads))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to grant resume uploads",
+		})
+		fmt.Println("AdminResumeQuotaGrant - ", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	var grantedUser models.User
+	initializers.DB.First(&grantedUser, "discord_id = ?", bodyData.DiscordId)
+	quota, err := currentResumeQuota(grantedUser, helpers.GetResumeQuotaPolicy())
+	if err != nil {
+		fmt.Println("AdminResumeQuotaGrant - ", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"discord_id":          grantedUser.DiscordId,
+		"resume_update_count": grantedUser.ResumeUpdateCount,
+		"resume_grant_count":  grantedUser.ResumeGrantCount,
+		"remaining_quota":     quota.Remaining,
+	})
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"github.com/utmmcss/deerhacks-backend/storage"
+	"gorm.io/gorm"
+)
+
+// Parses a search like `rust "machine learning" -java` the way web search engines do, with the
+// english text search configuration used for resumes
+const resumeSearchQuery = "websearch_to_tsquery('english', ?)"
+
+// Matched words are wrapped in <mark>, with up to three fragments of the resume per result
+const resumeHeadlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=20, MinWords=5, FragmentDelimiter=" … "`
+
+// Extracts the text of an uploaded resume for search. Resumes that cannot be read are still
+// accepted, they are just not searchable.
+func extractUploadedResumeText(fileData []byte, funcName string) string {
+	text, err := helpers.ExtractResumeText(fileData)
+	if err != nil {
+		fmt.Println(funcName, "- Failed to extract resume text:", err)
+	}
+	return text
+}
+
+// Stores the text of an application's resume and its search vector
+func saveResumeText(tx *gorm.DB, applicationId uint, text string) error {
+	return tx.Exec(
+		"UPDATE applications SET resume_text = ?, resume_search = to_tsvector('english', ?) WHERE id = ?",
+		text, text, applicationId,
+	).Error
+}
+
+// Extracts the text of resumes uploaded before resume search, in batches. Resumes that cannot be read
+// from storage are retried on the next run.
+func backfillResumeText() {
+	store, err := storage.Resumes()
+	if err != nil {
+		fmt.Println("ResumeTextBackfillTask - Error in opening resume storage: ", err)
+		return
+	}
+
+	var lastId uint
+	backfilled := 0
+	for {
+		var applications []models.Application
+		err := initializers.DB.Select("id", "discord_id", "resume_key").
+			Where("resume_hash <> '' AND resume_search IS NULL AND id > ?", lastId).
+			Order("id").
+			Limit(50).
+			Find(&applications).Error
+		if err != nil {
+			fmt.Println("ResumeTextBackfillTask - Failed to find resumes: ", err)
+			return
+		}
+		if len(applications) == 0 {
+			break
+		}
+
+		for _, application := range applications {
+			lastId = application.ID
+
+			key, err := currentResumeKey(application.DiscordId, application.ResumeKey)
+			if err != nil {
+				fmt.Println("ResumeTextBackfillTask - ", err)
+				return
+			}
+
+			resume, err := store.Get(key)
+			if err != nil {
+				fmt.Println("ResumeTextBackfillTask - Failed to read resume of user with discord_id", application.DiscordId, ":", err)
+				continue
+			}
+			fileData, err := io.ReadAll(io.LimitReader(resume, maxResumeBytes+1))
+			resume.Close()
+			if err != nil {
+				fmt.Println("ResumeTextBackfillTask - Failed to read resume of user with discord_id", application.DiscordId, ":", err)
+				continue
+			}
+
+			text := extractUploadedResumeText(fileData, "ResumeTextBackfillTask")
+			if err := saveResumeText(initializers.DB, application.ID, text); err != nil {
+				fmt.Println("ResumeTextBackfillTask - Failed to save resume text: ", err)
+				continue
+			}
+			backfilled++
+		}
+	}
+
+	if backfilled > 0 {
+		fmt.Println("ResumeTextBackfillTask - Extracted text of", backfilled, "resumes")
+	}
+}
+
+// ResumeTextBackfillTask extracts the text of resumes missing it on startup and then every interval
+func ResumeTextBackfillTask(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		fmt.Println("Resume Text Backfill Task running", time.Now())
+		backfillResumeText()
+		<-ticker.C
+	}
+}
+
+// Escapes a resume headline for display, keeping only the <mark> tags around matched words
+func escapeResumeHeadline(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, "&lt;mark&gt;", "<mark>")
+	return strings.ReplaceAll(escaped, "&lt;/mark&gt;", "</mark>")
+}
+
+// Runs a resume keyword search over query, an applications query joined with users, responding with
+// the best matches first and highlighted fragments of each resume
+func searchResumes(c *gin.Context, query *gorm.DB, funcName string) {
+	search := strings.TrimSpace(c.Query("q"))
+	if search == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Search query is required",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize := 25
+	offset := (page - 1) * pageSize
+
+	query = query.Where("applications.resume_search @@ "+resumeSearchQuery, search)
+
+	var totalResults int64
+	if err := query.Count(&totalResults).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search resumes",
+		})
+		fmt.Println(funcName, "- ", err)
+		return
+	}
+
+	type ResumeSearchResult struct {
+		DiscordId string
+		FirstName string
+		LastName  string
+		School    string
+		Program   string
+		Rank      float64
+		Headline  string
+	}
+
+	var results []ResumeSearchResult
+	err := query.
+		Select("users.discord_id, users.first_name, users.last_name, applications.school, applications.program, "+
+			"ts_rank(applications.resume_search, "+resumeSearchQuery+") AS rank, "+
+			"ts_headline('english', applications.resume_text, "+resumeSearchQuery+", ?) AS headline",
+			search, search, resumeHeadlineOptions).
+		Order("rank DESC, users.discord_id").
+		Limit(pageSize).
+		Offset(offset).
+		Scan(&results).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search resumes",
+		})
+		fmt.Println(funcName, "- ", err)
+		return
+	}
+
+	resultsResponse := []gin.H{}
+	for _, result := range results {
+		resultsResponse = append(resultsResponse, gin.H{
+			"discord_id": result.DiscordId,
+			"first_name": result.FirstName,
+			"last_name":  result.LastName,
+			"school":     result.School,
+			"program":    result.Program,
+			"rank":       result.Rank,
+			"headline":   escapeResumeHeadline(result.Headline),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": resultsResponse,
+		"pagination": gin.H{
+			"current_page":  page,
+			"total_pages":   int(math.Ceil(float64(totalResults) / float64(pageSize))),
+			"total_results": totalResults,
+		},
+	})
+}
+
+// AdminResumeSearch searches the text of every uploaded resume, e.g. ?q=rust
+func AdminResumeSearch(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	query := initializers.DB.Model(&models.Application{}).
+		Joins("join users on users.discord_id = applications.discord_id AND users.deleted_at IS NULL")
+
+	searchResumes(c, query, "AdminResumeSearch")
+}
+
+// SponsorResumeSearch searches the resumes of the consenting attendees sponsors can see, leaving out
+// resumes flagged as infected since sponsors cannot open them
+func SponsorResumeSearch(c *gin.Context) {
+	query := sponsorCandidateQuery().
+		Where("applications.resume_scan_status IS NULL OR applications.resume_scan_status <> ?", helpers.ResumeScanInfected)
+
+	searchResumes(c, query, "SponsorResumeSearch")
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"github.com/utmmcss/deerhacks-backend/storage"
+)
+
+// Days prior resume versions are kept for (default 180), 0 keeps them until there are too many
+func resumeVersionRetention() time.Duration {
+	days := 180
+	if value, err := strconv.Atoi(os.Getenv("RESUME_VERSION_RETENTION_DAYS")); err == nil && value >= 0 {
+		days = value
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Most prior resume versions kept per hacker (default 10), on top of the current one
+func resumeVersionMax() int {
+	versions := 10
+	if value, err := strconv.Atoi(os.Getenv("RESUME_VERSION_MAX")); err == nil && value >= 0 {
+		versions = value
+	}
+	return versions
+}
+
+// Deletes the prior resume versions of every hacker that are past the retention period or beyond the
+// most kept. The current version, and versions within the resume quota window, are never pruned.
+// Versions whose file cannot be deleted are retried on the next run.
+func pruneResumeVersions() {
+	store, err := storage.Resumes()
+	if err != nil {
+		fmt.Println("ResumeVersionPruneTask - Error in opening resume storage: ", err)
+		return
+	}
+
+	retention := resumeVersionRetention()
+	maxVersions := resumeVersionMax()
+	quotaWindow := helpers.GetResumeQuotaPolicy().Window
+
+	var discordIds []string
+	err = initializers.DB.Model(&models.ResumeVersion{}).
+		Group("discord_id").
+		Having("COUNT(*) > 1").
+		Pluck("discord_id", &discordIds).Error
+	if err != nil {
+		fmt.Println("ResumeVersionPruneTask - Failed to find resume versions: ", err)
+		return
+	}
+
+	pruned := 0
+	for _, discordId := range discordIds {
+		var application models.Application
+		if err := initializers.DB.Select("discord_id", "resume_key").Where("discord_id = ?", discordId).First(&application).Error; err != nil {
+			fmt.Println("ResumeVersionPruneTask - Failed to find application of user with discord_id", discordId, ":", err)
+			continue
+		}
+
+		var versions []models.ResumeVersion
+		if err := initializers.DB.Where("discord_id = ?", discordId).Order("created_at DESC, id DESC").Find(&versions).Error; err != nil {
+			fmt.Println("ResumeVersionPruneTask - Failed to find resume versions: ", err)
+			continue
+		}
+
+		kept := 0
+		for _, version := range versions {
+			// Versions within the quota window are the uploads it counts, so they are kept until they leave it
+			if version.Key == application.ResumeKey || time.Since(version.CreatedAt) < quotaWindow {
+				continue
+			}
+			if kept < maxVersions && (retention == 0 || time.Since(version.CreatedAt) < retention) {
+				kept++
+				continue
+			}
+
+			if err := store.Delete(version.Key); err != nil {
+				fmt.Println("ResumeVersionPruneTask - Failed to delete resume version", version.ID, ":", err)
+				continue
+			}
+			if err := initializers.DB.Unscoped().Delete(&version).Error; err != nil {
+				fmt.Println("ResumeVersionPruneTask - Failed to delete resume version", version.ID, ":", err)
+				continue
+			}
+			pruned++
+		}
+	}
+
+	if pruned > 0 {
+		fmt.Println("ResumeVersionPruneTask - Pruned", pruned, "resume versions")
+	}
+}
+
+// ResumeVersionPruneTask prunes old resume versions every interval
+func ResumeVersionPruneTask(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		<-ticker.C
+		fmt.Println("Resume Version Prune Task running", time.Now())
+		pruneResumeVersions()
+	}
+}
+
+// AdminResumeVersionsGet lists every kept version of a hacker's resume, newest first, with links to
+// download each one
+func AdminResumeVersionsGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	discordId := c.Query("discord_id")
+	if discordId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "discord_id is required",
+		})
+		return
+	}
+
+	var application models.Application
+	initializers.DB.Where("discord_id = ?", discordId).First(&application)
+	if application.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Application not found",
+		})
+		return
+	}
+
+	var versions []models.ResumeVersion
+	if err := initializers.DB.Where("discord_id = ?", discordId).Order("created_at DESC, id DESC").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch resume versions",
+		})
+		fmt.Println("AdminResumeVersionsGet - ", err)
+		return
+	}
+
+	store, err := storage.Resumes()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("AdminResumeVersionsGet - Error in opening resume storage: ", err)
+		return
+	}
+
+	versionsResponse := []gin.H{}
+	for _, version := range versions {
+		link, err := store.Presign(version.Key, version.Filename, resumeLinkExpiry)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			fmt.Println("AdminResumeVersionsGet - Error in getting presigned url: ", err)
+			return
+		}
+
+		versionsResponse = append(versionsResponse, gin.H{
+			"id":            version.ID,
+			"filename":      version.Filename,
+			"hash":          version.Hash,
+			"size":          version.Size,
+			"uploaded_at":   version.CreatedAt.Format(time.RFC3339),
+			"current":       version.Key == application.ResumeKey,
+			"download_link": link,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resume_versions": versionsResponse,
+		"resume_expiry":   time.Now().Add(resumeLinkExpiry).Format(time.RFC3339),
+	})
+}
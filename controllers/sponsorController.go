@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"github.com/utmmcss/deerhacks-backend/storage"
+	"gorm.io/gorm"
+)
+
+// How long resume links given to sponsors stay valid, short so every view goes through the log
+const sponsorResumeLinkExpiry = 15 * time.Minute
+
+// Public profile of a hacker as shown to sponsors
+type sponsorCandidate struct {
+	DiscordId      string
+	FirstName      string
+	LastName       string
+	Education      string
+	School         string
+	Program        string
+	GraduationYear int
+	Interests      string
+	Skills         string
+	Github         string
+	Linkedin       string
+	Portfolio      string
+	HasResume      bool
+	Starred        bool
+}
+
+// Submitted applications of hackers with one of statuses who consented to sharing their resume, the only
+// applications sponsors and resume books can include
+func consentingApplicationQuery(statuses []models.Status) *gorm.DB {
+	return initializers.DB.Model(&models.Application{}).
+		Joins("join users on users.discord_id = applications.discord_id AND users.deleted_at IS NULL").
+		Where("users.status IN ?", statuses).
+		Where("applications.resume_consent = ? AND applications.is_draft = ?", true, false)
+}
+
+// Applications sponsors can see, those of attending hackers who consented to sharing their resume
+func sponsorCandidateQuery() *gorm.DB {
+	return consentingApplicationQuery(resumeBookStatuses)
+}
+
+// Matches applications whose JSON array column contains any of values, ignoring case
+func jsonArrayContainsAny(query *gorm.DB, column string, values []string) *gorm.DB {
+	conditions := []string{}
+	params := []interface{}{}
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			conditions = append(conditions, "EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE("+column+", '[]')) AS element WHERE element ILIKE ?)")
+			params = append(params, value)
+		}
+	}
+	if len(conditions) == 0 {
+		return query
+	}
+	return query.Where(strings.Join(conditions, " OR "), params...)
+}
+
+// Splits a JSON array column read as text, such as ["Go", "React"]
+func parseJSONArray(raw string) []string {
+	values := []string{}
+	var array []string
+	if err := json.Unmarshal([]byte(raw), &array); err == nil {
+		values = append(values, array...)
+	}
+	return values
+}
+
+// SponsorCandidatesGet searches the public profiles of consenting attendees. Filters by school and
+// program match partially, interests and skills take comma separated values and match any of them,
+// and starred=true only returns the sponsor's starred candidates.
+func SponsorCandidatesGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize := 25
+	offset := (page - 1) * pageSize
+
+	query := sponsorCandidateQuery()
+
+	if school := strings.TrimSpace(c.Query("school")); school != "" {
+		query = query.Where("applications.school ILIKE ?", "%"+school+"%")
+	}
+	if program := strings.TrimSpace(c.Query("program")); program != "" {
+		query = query.Where("applications.program ILIKE ?", "%"+program+"%")
+	}
+	if interests := c.Query("interests"); interests != "" {
+		query = jsonArrayContainsAny(query, "applications.interests", strings.Split(interests, ","))
+	}
+	if skills := c.Query("skills"); skills != "" {
+		query = jsonArrayContainsAny(query, "applications.skills", strings.Split(skills, ","))
+	}
+
+	starredQuery := initializers.DB.Model(&models.SponsorStar{}).Select("discord_id").Where("sponsor_id = ?", user.DiscordId)
+	if c.Query("starred") == "true" {
+		query = query.Where("applications.discord_id IN (?)", starredQuery)
+	}
+
+	var totalCandidates int64
+	if err := query.Count(&totalCandidates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search candidates",
+		})
+		fmt.Println("SponsorCandidatesGet - ", err)
+		return
+	}
+
+	var candidates []sponsorCandidate
+	err := query.
+		Select("users.discord_id, users.first_name, users.last_name, applications.education, applications.school, applications.program, "+
+			"COALESCE(applications.graduation_year, 0) AS graduation_year, COALESCE(applications.interests, '[]')::text AS interests, COALESCE(applications.skills, '[]')::text AS skills, "+
+			"applications.github, applications.linkedin, applications.portfolio, "+
+			"(applications.resume_hash <> '' AND (applications.resume_scan_status IS NULL OR applications.resume_scan_status <> ?)) AS has_resume, "+
+			"applications.discord_id IN (?) AS starred", helpers.ResumeScanInfected, starredQuery).
+		Order("users.last_name, users.first_name").
+		Limit(pageSize).
+		Offset(offset).
+		Scan(&candidates).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search candidates",
+		})
+		fmt.Println("SponsorCandidatesGet - ", err)
+		return
+	}
+
+	candidatesResponse := []gin.H{}
+	for _, candidate := range candidates {
+		candidatesResponse = append(candidatesResponse, gin.H{
+			"discord_id":      candidate.DiscordId,
+			"first_name":      candidate.FirstName,
+			"last_name":       candidate.LastName,
+			"education":       candidate.Education,
+			"school":          candidate.School,
+			"program":         candidate.Program,
+			"graduation_year": candidate.GraduationYear,
+			"interests":       parseJSONArray(candidate.Interests),
+			"skills":          parseJSONArray(candidate.Skills),
+			"github":          candidate.Github,
+			"linkedin":        candidate.Linkedin,
+			"portfolio":       candidate.Portfolio,
+			"has_resume":      candidate.HasResume,
+			"starred":         candidate.Starred,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"candidates": candidatesResponse,
+		"pagination": gin.H{
+			"current_page":     page,
+			"total_pages":      int(math.Ceil(float64(totalCandidates) / float64(pageSize))),
+			"total_candidates": totalCandidates,
+		},
+	})
+}
+
+// Finds the application of a candidate sponsors can see, returning false if there is none
+func findSponsorCandidate(discordId string) (models.Application, bool) {
+	var application models.Application
+	sponsorCandidateQuery().Select("applications.*").Where("applications.discord_id = ?", discordId).First(&application)
+	return application, application.ID != 0
+}
+
+// SponsorStarUpdate stars or unstars a candidate for the sponsor
+func SponsorStarUpdate(c *gin.Context) {
+
+	type StarBody struct {
+		DiscordId string `json:"discord_id"`
+		Starred   bool   `json:"starred"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	var bodyData StarBody
+	if err := c.Bind(&bodyData); err != nil || bodyData.DiscordId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	if _, ok := findSponsorCandidate(bodyData.DiscordId); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Candidate not found",
+		})
+		return
+	}
+
+	var err error
+	if bodyData.Starred {
+		star := models.SponsorStar{SponsorId: user.DiscordId, DiscordId: bodyData.DiscordId}
+		err = initializers.DB.Where(&star).FirstOrCreate(&star).Error
+	} else {
+		err = initializers.DB.Unscoped().Where("sponsor_id = ? AND discord_id = ?", user.DiscordId, bodyData.DiscordId).Delete(&models.SponsorStar{}).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update star",
+		})
+		fmt.Println("SponsorStarUpdate - ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"discord_id": bodyData.DiscordId,
+		"starred":    bodyData.Starred,
+	})
+}
+
+// SponsorResumeGet logs the view and returns a short lived link to a candidate's resume
+func SponsorResumeGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	discordId := c.Query("discord_id")
+	application, ok := findSponsorCandidate(discordId)
+	if !ok || application.ResumeHash == "" || application.ResumeScanStatus == helpers.ResumeScanInfected {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Resume not found",
+		})
+		return
+	}
+
+	var candidate models.User
+	initializers.DB.First(&candidate, "discord_id = ?", discordId)
+
+	store, err := storage.Resumes()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("SponsorResumeGet - Error in opening resume storage: ", err)
+		return
+	}
+
+	key, err := currentResumeKey(discordId, application.ResumeKey)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("SponsorResumeGet - ", err)
+		return
+	}
+
+	// The view is logged before the link is given out, so no view goes unrecorded
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
+	}
+	view := models.ResumeView{
+		ViewerId:  user.DiscordId,
+		DiscordId: discordId,
+		IPAddress: c.ClientIP(),
+		UserAgent: userAgent,
+	}
+	if err := initializers.DB.Create(&view).Error; err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("SponsorResumeGet - Failed to log resume view: ", err)
+		return
+	}
+
+	filename := resumeBookFilename(resumeBookEntry{DiscordId: discordId, FirstName: candidate.FirstName, LastName: candidate.LastName})
+	link, err := store.Presign(key, filename, sponsorResumeLinkExpiry)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("SponsorResumeGet - Error in getting presigned url: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resume_file_name": filename,
+		"resume_link":      link,
+		"resume_expiry":    time.Now().Add(sponsorResumeLinkExpiry).Format(time.RFC3339),
+	})
+}
+
+// AdminResumeViewsGet lists sponsor resume views, optionally for one viewer or one hacker's resume
+func AdminResumeViewsGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	query := initializers.DB.Model(&models.ResumeView{})
+	if viewerId := c.Query("viewer_id"); viewerId != "" {
+		query = query.Where("viewer_id = ?", viewerId)
+	}
+	if discordId := c.Query("discord_id"); discordId != "" {
+		query = query.Where("discord_id = ?", discordId)
+	}
+
+	var views []models.ResumeView
+	if err := query.Order("created_at DESC").Limit(500).Find(&views).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch resume views",
+		})
+		fmt.Println("AdminResumeViewsGet - ", err)
+		return
+	}
+
+	viewsResponse := []gin.H{}
+	for _, view := range views {
+		viewsResponse = append(viewsResponse, gin.H{
+			"viewer_id":  view.ViewerId,
+			"discord_id": view.DiscordId,
+			"ip_address": view.IPAddress,
+			"user_agent": view.UserAgent,
+			"viewed_at":  view.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resume_views": viewsResponse,
+	})
+}
@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+// Statuses allowed to check in for food contexts (see AdminQRCheckIn)
+var foodEligibleStatuses = []string{string(models.Attended), string(models.Moderator), string(models.Volunteer), string(models.Guest)}
+
+type checkInBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+type contextStats struct {
+	CheckedIn         int64                   `json:"checked_in"`
+	Scans             int64                   `json:"scans"`
+	ScansByStatus     map[models.Status]int64 `json:"scans_by_status"`
+	RemainingEligible int64                   `json:"remaining_eligible"`
+	Buckets           []checkInBucket         `json:"buckets"`
+}
+
+// Check in broadcaster for the live dashboard stream
+var (
+	checkInSubscribers   = make(map[chan models.CheckInEvent]struct{})
+	checkInSubscribersMu sync.Mutex
+)
+
+func subscribeCheckIns() chan models.CheckInEvent {
+	ch := make(chan models.CheckInEvent, 16)
+
+	checkInSubscribersMu.Lock()
+	checkInSubscribers[ch] = struct{}{}
+	checkInSubscribersMu.Unlock()
+
+	return ch
+}
+
+func unsubscribeCheckIns(ch chan models.CheckInEvent) {
+	checkInSubscribersMu.Lock()
+	delete(checkInSubscribers, ch)
+	checkInSubscribersMu.Unlock()
+}
+
+// Postgres channel every instance listens on, so dashboards see check ins scanned through any replica
+const checkInNotifyChannel = "check_ins"
+
+// How long to wait before reconnecting after the check in listen connection fails
+const checkInListenReconnectDelay = 10 * time.Second
+
+// Notifies every listening instance, including this one, of the check in
+func publishCheckIn(event models.CheckInEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("publishCheckIn - ", err)
+		return
+	}
+	if err := initializers.DB.Exec("SELECT pg_notify(?, ?)", checkInNotifyChannel, string(payload)).Error; err != nil {
+		fmt.Println("publishCheckIn - ", err)
+	}
+}
+
+// Sends the check in to the dashboards connected to this instance
+func fanOutCheckIn(event models.CheckInEvent) {
+	checkInSubscribersMu.Lock()
+	defer checkInSubscribersMu.Unlock()
+
+	for ch := range checkInSubscribers {
+		// Drop the event for slow dashboards instead of blocking the check in
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// ListenCheckIns listens for check in notifications on a dedicated connection and passes them to the
+// dashboards connected to this instance, reconnecting when the connection drops
+func ListenCheckIns(dsn string) {
+	for {
+		if err := listenCheckIns(dsn); err != nil {
+			fmt.Printf("ListenCheckIns - Listen connection failed, reconnecting in %v: %v\n", checkInListenReconnectDelay, err)
+		}
+		time.Sleep(checkInListenReconnectDelay)
+	}
+}
+
+func listenCheckIns(dsn string) error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+checkInNotifyChannel); err != nil {
+		return err
+	}
+	fmt.Println("ListenCheckIns - Listening for check in notifications")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event models.CheckInEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			fmt.Println("ListenCheckIns - ", err)
+			continue
+		}
+		fanOutCheckIn(event)
+	}
+}
+
+func recordCheckIn(scannedUser *models.User, context QRCheckInContext, scanner *models.User) {
+	event := models.CheckInEvent{
+		DiscordId: scannedUser.DiscordId,
+		Context:   string(context),
+		Status:    scannedUser.Status,
+		ScannedBy: scanner.DiscordId,
+	}
+
+	if err := initializers.DB.Create(&event).Error; err != nil {
+		fmt.Println("recordCheckIn - Failed to save check in event:", err)
+		return
+	}
+
+	publishCheckIn(event)
+}
+
+func getContextStats(context QRCheckInContext) (*contextStats, error) {
+
+	stats := contextStats{
+		ScansByStatus: make(map[models.Status]int64),
+		Buckets:       []checkInBucket{},
+	}
+
+	type statusCount struct {
+		Status models.Status
+		Count  int64
+	}
+
+	var statusCounts []statusCount
+	err := initializers.DB.Model(&models.CheckInEvent{}).
+		Select("status, COUNT(*) AS count").
+		Where("context = ?", string(context)).
+		Group("status").
+		Scan(&statusCounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sc := range statusCounts {
+		stats.ScansByStatus[sc.Status] = sc.Count
+		stats.Scans += sc.Count
+	}
+
+	// Group scans into 15 minute buckets
+	err = initializers.DB.Model(&models.CheckInEvent{}).
+		Select("to_timestamp(floor(extract(epoch from created_at) / 900) * 900) AS start, COUNT(*) AS count").
+		Where("context = ?", string(context)).
+		Group("start").
+		Order("start").
+		Scan(&stats.Buckets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if context == REGISTRATION {
+		// Registration moves accepted hackers to attended instead of recording a check in count
+		if err := initializers.DB.Model(&models.User{}).Where("status = ?", models.Attended).Count(&stats.CheckedIn).Error; err != nil {
+			return nil, err
+		}
+		if err := initializers.DB.Model(&models.User{}).Where("status = ?", models.Accepted).Count(&stats.RemainingEligible).Error; err != nil {
+			return nil, err
+		}
+		return &stats, nil
+	}
+
+	err = initializers.DB.Model(&models.User{}).
+		Where("COALESCE((check_ins->>?)::int, 0) > 0", string(context)).
+		Count(&stats.CheckedIn).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = initializers.DB.Model(&models.User{}).
+		Where("status IN ? AND COALESCE((check_ins->>?)::int, 0) = 0", foodEligibleStatuses, string(context)).
+		Count(&stats.RemainingEligible).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func getCheckInStats(contexts []QRCheckInContext) (gin.H, error) {
+
+	type statusCount struct {
+		Status models.Status
+		Count  int64
+	}
+
+	var statusCounts []statusCount
+	err := initializers.DB.Model(&models.User{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&statusCounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[models.Status]int64)
+	for _, sc := range statusCounts {
+		users[sc.Status] = sc.Count
+	}
+
+	contextsResponse := make(map[QRCheckInContext]*contextStats)
+	for _, context := range contexts {
+		stats, err := getContextStats(context)
+		if err != nil {
+			return nil, err
+		}
+		contextsResponse[context] = stats
+	}
+
+	return gin.H{
+		"on_site":  users[models.Attended],
+		"users":    users,
+		"contexts": contextsResponse,
+	}, nil
+}
+
+// Parses the optional 'context' query parameter, defaulting to every check in context
+func parseStatsContexts(c *gin.Context) ([]QRCheckInContext, bool) {
+	context := QRCheckInContext(c.DefaultQuery("context", ""))
+	if context == "" {
+		return QRCheckInContexts, true
+	}
+
+	for _, valid := range QRCheckInContexts {
+		if context == valid {
+			return []QRCheckInContext{context}, true
+		}
+	}
+	return nil, false
+}
+
+func AdminCheckInStats(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	contexts, ok := parseStatsContexts(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid context",
+		})
+		return
+	}
+
+	stats, err := getCheckInStats(contexts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get check in stats",
+		})
+		fmt.Println("AdminCheckInStats - ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// AdminCheckInStream pushes a "checkin" event for every successful AdminQRCheckIn
+// followed by refreshed stats for that context, using Server-Sent Events.
+func AdminCheckInStream(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	contexts, ok := parseStatsContexts(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid context",
+		})
+		return
+	}
+
+	events := subscribeCheckIns()
+	defer unsubscribeCheckIns(events)
+
+	// Keep proxies from buffering the stream
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	// Send the current stats so the dashboard can render immediately
+	if stats, err := getCheckInStats(contexts); err == nil {
+		c.SSEvent("stats", stats)
+	} else {
+		fmt.Println("AdminCheckInStream - ", err)
+	}
+	// c.Stream only flushes after a step, which waits for the next check in or heartbeat
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Format(time.RFC3339))
+			return true
+		case event := <-events:
+			context := QRCheckInContext(event.Context)
+			if len(contexts) == 1 && contexts[0] != context {
+				return true
+			}
+
+			c.SSEvent("checkin", gin.H{
+				"discord_id": event.DiscordId,
+				"context":    event.Context,
+				"status":     event.Status,
+				"time":       event.CreatedAt,
+			})
+
+			stats, err := getCheckInStats([]QRCheckInContext{context})
+			if err != nil {
+				fmt.Println("AdminCheckInStream - ", err)
+				return true
+			}
+			c.SSEvent("stats", stats)
+			return true
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/discord"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm"
+)
+
+var errTeamNotFound = errors.New("team not found")
+
+func AdminTeamsGet(c *gin.Context) {
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var teams []models.Team
+	if err := initializers.DB.Order("name").Find(&teams).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch teams",
+		})
+		fmt.Println("AdminTeamsGet - ", err)
+		return
+	}
+
+	var members []models.TeamMember
+	if err := initializers.DB.Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch team members",
+		})
+		fmt.Println("AdminTeamsGet - ", err)
+		return
+	}
+
+	membersByTeam := make(map[uint][]string)
+	for _, member := range members {
+		membersByTeam[member.TeamId] = append(membersByTeam[member.TeamId], member.DiscordId)
+	}
+
+	teamsResponse := []gin.H{}
+	for _, team := range teams {
+		teamMembers := membersByTeam[team.ID]
+		if teamMembers == nil {
+			teamMembers = []string{}
+		}
+		teamsResponse = append(teamsResponse, gin.H{
+			"id":               team.ID,
+			"name":             team.Name,
+			"members":          teamMembers,
+			"archived":         team.Archived,
+			"text_channel_id":  team.TextChannelId,
+			"voice_channel_id": team.VoiceChannelId,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"teams": teamsResponse,
+	})
+}
+
+// AdminTeamUpdate creates a team when no id is given, otherwise renames, archives or replaces the
+// members of an existing team. Members already on another team are moved to this one. The team's
+// discord channels, and those of any team that lost members, are synced through the team channel queue.
+func AdminTeamUpdate(c *gin.Context) {
+
+	type TeamBody struct {
+		ID       uint     `json:"id,omitempty"`
+		Name     string   `json:"name,omitempty"`
+		Members  []string `json:"members,omitempty"`
+		Archived *bool    `json:"archived,omitempty"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Admin && user.Status != models.Moderator {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Admins or Moderators only",
+		})
+		return
+	}
+
+	var bodyData TeamBody
+	if err := c.Bind(&bodyData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	bodyData.Name = strings.TrimSpace(bodyData.Name)
+	if bodyData.ID == 0 && bodyData.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Team name is required",
+		})
+		return
+	}
+
+	if len(bodyData.Name) > 128 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Team name is too long",
+		})
+		return
+	}
+
+	if bodyData.Members != nil {
+		var found int64
+		initializers.DB.Model(&models.User{}).Where("discord_id IN ?", bodyData.Members).Count(&found)
+		if int(found) != len(bodyData.Members) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid team members provided",
+			})
+			return
+		}
+	}
+
+	var team models.Team
+	affectedTeams := []uint{}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if bodyData.ID != 0 {
+			tx.First(&team, bodyData.ID)
+			if team.ID == 0 {
+				return errTeamNotFound
+			}
+		}
+
+		if bodyData.Name != "" {
+			team.Name = bodyData.Name
+		}
+		if bodyData.Archived != nil {
+			team.Archived = *bodyData.Archived
+		}
+		if err := tx.Save(&team).Error; err != nil {
+			return err
+		}
+
+		if bodyData.Members == nil {
+			return nil
+		}
+
+		// Teams losing members to this one need their channels synced too
+		if len(bodyData.Members) > 0 {
+			if err := tx.Model(&models.TeamMember{}).
+				Where("discord_id IN ? AND team_id <> ?", bodyData.Members, team.ID).
+				Distinct().
+				Pluck("team_id", &affectedTeams).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("discord_id IN ?", bodyData.Members).Delete(&models.TeamMember{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("team_id = ?", team.ID).Delete(&models.TeamMember{}).Error; err != nil {
+			return err
+		}
+
+		for _, discordId := range bodyData.Members {
+			if err := tx.Create(&models.TeamMember{TeamId: team.ID, DiscordId: discordId}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if errors.Is(err, errTeamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Team not found",
+		})
+		return
+	} else if err != nil && helpers.IsUniqueViolationError(err) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Team name already in use",
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update team",
+		})
+		fmt.Println("AdminTeamUpdate - ", err)
+		return
+	}
+
+	for _, teamId := range append(affectedTeams, team.ID) {
+		if err := discord.EnqueueTeam(teamId); err != nil {
+			fmt.Println("AdminTeamUpdate - Failed to enqueue team: ", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id": team.ID,
+	})
+}
@@ -41,6 +41,19 @@ func GetUser(c *gin.Context) {
 	responseMap["status"] = user.Status
 	responseMap["qr_code"] = user.QRCode
 	responseMap["avatar"] = user.Avatar
+	responseMap["nickname_opt_out"] = user.NicknameOptOut
+
+	points, pointHistory, err := getUserPoints(user.DiscordId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get user points",
+		})
+		fmt.Println("GetUser - ", err)
+		return
+	}
+
+	responseMap["points"] = points
+	responseMap["point_history"] = pointHistory
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": responseMap,
@@ -83,16 +96,20 @@ func UpdateUser(c *gin.Context) {
 
 	var isUserChanged bool = false
 	var isEmailChanged bool = false
+	var isNameChanged bool = false
+	var isStatusChanged bool = false
 
 	// Update the user object with the new information (if applicable)
 	if bodyData.FirstName != "" && bodyData.FirstName != user.FirstName {
 		user.FirstName = bodyData.FirstName
 		isUserChanged = true
+		isNameChanged = true
 	}
 
 	if bodyData.LastName != "" && bodyData.LastName != user.LastName {
 		user.LastName = bodyData.LastName
 		isUserChanged = true
+		isNameChanged = true
 	}
 
 	if bodyData.Email != "" && (user.Status == models.Pending || (user.Status == models.Registering && bodyData.Email != user.Email)) {
@@ -116,7 +133,7 @@ func UpdateUser(c *gin.Context) {
 
 		if user.Status == models.Registering {
 			user.Status = models.Pending
-			discord.EnqueueUser(&user, "update")
+			isStatusChanged = true
 		}
 		isUserChanged = true
 	}
@@ -143,6 +160,11 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Sync the discord roles and nickname once the new status and name are saved
+	if isNameChanged || isStatusChanged {
+		discord.EnqueueUser(&user, "update")
+	}
+
 	if isEmailChanged {
 
 		if user.EmailChangeCount == 20 {
@@ -162,3 +184,41 @@ func UpdateUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{})
 }
+
+// UpdateNicknameOptOut sets whether the user's discord nickname is synced with their registered name.
+// Opting out clears the synced nickname, leaving any nickname the user set themselves.
+func UpdateNicknameOptOut(c *gin.Context) {
+
+	type NicknameBody struct {
+		OptOut *bool `json:"opt_out"`
+	}
+
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	var bodyData NicknameBody
+	if err := c.Bind(&bodyData); err != nil || bodyData.OptOut == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Request Body",
+		})
+		return
+	}
+
+	if *bodyData.OptOut == user.NicknameOptOut {
+		c.JSON(http.StatusOK, gin.H{})
+		return
+	}
+
+	user.NicknameOptOut = *bodyData.OptOut
+	if err := initializers.DB.Model(&user).Update("nickname_opt_out", user.NicknameOptOut).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update user",
+		})
+		fmt.Println("UpdateNicknameOptOut - ", err)
+		return
+	}
+
+	discord.EnqueueUser(&user, "update")
+
+	c.JSON(http.StatusOK, gin.H{})
+}
@@ -0,0 +1,226 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RESTClient sends authenticated requests to the discord REST API. A fake discord server can
+// back it in tests, either through NewClient with the server's URL or a custom implementation.
+type RESTClient interface {
+	Request(method string, path string, body interface{}) (*http.Response, error)
+}
+
+// Number of times a request is retried after a 429 before the response is returned to the caller
+const maxRateLimitRetries = 2
+
+type rateLimitBucket struct {
+	remaining int
+	reset     time.Time
+}
+
+// Client is a RESTClient that tracks discord's rate limit buckets, waiting before a request
+// would exceed a bucket or the global limit instead of reacting to 429s after the fact.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+
+	mu           sync.Mutex
+	routeBuckets map[string]string           // route -> bucket id from X-RateLimit-Bucket
+	buckets      map[string]*rateLimitBucket // bucket id + major parameter -> state
+	globalReset  time.Time
+}
+
+func NewClient(baseURL string, token string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		token:        token,
+		httpClient:   httpClient,
+		routeBuckets: make(map[string]string),
+		buckets:      make(map[string]*rateLimitBucket),
+	}
+}
+
+var (
+	restClient   RESTClient
+	restClientMu sync.RWMutex
+)
+
+func apiBaseURL() string {
+	if baseURL := os.Getenv("DISCORD_API_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return "https://discord.com/api/v10"
+}
+
+// API returns the shared discord client, created from BOT_TOKEN and DISCORD_API_URL on first use
+func API() RESTClient {
+	restClientMu.RLock()
+	client := restClient
+	restClientMu.RUnlock()
+
+	if client != nil {
+		return client
+	}
+
+	restClientMu.Lock()
+	defer restClientMu.Unlock()
+	if restClient == nil {
+		restClient = NewClient(apiBaseURL(), os.Getenv("BOT_TOKEN"), &http.Client{Timeout: 30 * time.Second})
+	}
+	return restClient
+}
+
+// SetAPI replaces the shared discord client, such as with one backed by a fake discord server
+func SetAPI(client RESTClient) {
+	restClientMu.Lock()
+	restClient = client
+	restClientMu.Unlock()
+}
+
+// Discord rate limits per route, where a route shares a bucket for every value of its
+// minor parameters (e.g. user ids) but not of its major parameters (guild, channel and webhook ids).
+func routeKey(method string, path string) (route string, major string) {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if _, err := strconv.ParseUint(segment, 10, 64); err != nil || i == 0 {
+			continue
+		}
+		switch segments[i-1] {
+		case "guilds", "channels", "webhooks":
+			if major == "" {
+				major = segment
+			}
+		default:
+			segments[i] = ":id"
+		}
+	}
+	return method + " /" + strings.Join(segments, "/"), major
+}
+
+// Waits until the global limit and the route's bucket allow another request, then reserves it
+func (c *Client) waitForBucket(route string, major string) {
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		wait := c.globalReset.Sub(now)
+
+		if bucketId, ok := c.routeBuckets[route]; ok {
+			if b, ok := c.buckets[bucketId+":"+major]; ok {
+				if now.After(b.reset) {
+					// The bucket has reset, but we only learn its new size from the next response
+					b.remaining = 1
+					b.reset = now.Add(time.Second)
+				}
+				if b.remaining <= 0 && b.reset.Sub(now) > wait {
+					wait = b.reset.Sub(now)
+				} else if wait <= 0 {
+					b.remaining--
+				}
+			}
+		}
+		c.mu.Unlock()
+
+		if wait <= 0 {
+			return
+		}
+		fmt.Printf("(client.waitForBucket) Waiting %v for rate limit on %s\n", wait, route)
+		time.Sleep(wait)
+	}
+}
+
+// Updates the bucket state from the rate limit headers of a response
+func (c *Client) updateBucket(route string, major string, resp *http.Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("X-RateLimit-Global") == "true" {
+		if retryAfter, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+			c.globalReset = time.Now().Add(time.Duration(retryAfter * float64(time.Second)))
+		}
+		return
+	}
+
+	bucketId := resp.Header.Get("X-RateLimit-Bucket")
+	if bucketId == "" {
+		return
+	}
+	c.routeBuckets[route] = bucketId
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetAfter, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+
+	c.buckets[bucketId+":"+major] = &rateLimitBucket{
+		remaining: remaining,
+		reset:     time.Now().Add(time.Duration(resetAfter * float64(time.Second))),
+	}
+}
+
+// Request sends a request to path (relative to the API base URL) with body encoded as JSON.
+// A 429 is retried after its Retry-After, and is only returned once the retries are used up.
+func (c *Client) Request(method string, path string, body interface{}) (*http.Response, error) {
+	var jsonData []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON data: %w", err)
+		}
+		jsonData = data
+	}
+
+	route, major := routeKey(method, path)
+
+	for attempt := 0; ; attempt++ {
+		c.waitForBucket(route, major)
+
+		var reqBody io.Reader
+		if jsonData != nil {
+			reqBody = bytes.NewReader(jsonData)
+		}
+
+		req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("error forming request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bot "+c.token)
+		if jsonData != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		c.updateBucket(route, major, resp)
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRateLimitRetries {
+			return resp, nil
+		}
+
+		retryAfter, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+		if err != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		fmt.Printf("(client.Request) Rate limited on %s, retrying after %vs\n", route, retryAfter)
+		time.Sleep(time.Duration(retryAfter * float64(time.Second)))
+	}
+}
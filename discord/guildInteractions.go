@@ -1,7 +1,6 @@
 package discord
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,165 +11,157 @@ import (
 	"github.com/utmmcss/deerhacks-backend/models"
 )
 
-type DiscordRole string
-
-const (
-	PendingDiscord     DiscordRole = "1087192865186254999" // Pending Email Verification
-	RegisteringDiscord DiscordRole = "1087193230157819925" // Email Verified, Registering for DeerHacks
-	AppliedDiscord     DiscordRole = "1192983763995602964" // Application Submitted
-	SelectedDiscord    DiscordRole = "1192983889807933490" // Selected to Attend DeerHacks, Pending Confirmation
-	AcceptedDiscord    DiscordRole = "1192984014571704330" // Accepted to Attend DeerHacks
-	AttendedDiscord    DiscordRole = "1192984114987548722" // Signed in at DeerHacks
-	VolunteerDiscord   DiscordRole = "1100893133581070476" // Volunteer at DeerHacks
-	DefaultDiscord     DiscordRole = "1085682655326130316" // Status unknown
-)
-
 type RateLimitResponse struct {
 	Message    string  `json:"message"`
 	RetryAfter float64 `json:"retry_after"`
 	Global     bool    `json:"global"`
 }
 
-func StatusToDiscordRole(s models.Status) DiscordRole {
-	switch s {
-	case models.Pending:
-		return PendingDiscord
-	case models.Registering:
-		return RegisteringDiscord
-	case models.Applied:
-		return AppliedDiscord
-	case models.Selected:
-		return SelectedDiscord
-	case models.Accepted:
-		return AcceptedDiscord
-	case models.Attended:
-		return AttendedDiscord
-	case models.Volunteer:
-		return VolunteerDiscord
-	default:
-		return DefaultDiscord
-	}
+// RateLimitError is returned when discord responds with 429, so the queue can retry after RetryAfter
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Global     bool
 }
 
-func UpdateGuildUserRole(user *models.User, retry bool) bool {
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %v (global: %t)", e.RetryAfter, e.Global)
+}
 
-	type DiscordMember struct {
-		Roles []DiscordRole `json:"roles"`
+// Builds a RateLimitError from a 429 response body
+func parseRateLimit(resp *http.Response) error {
+	var rateLimit RateLimitResponse
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read rate limit response body: %w", err)
 	}
 
-	baseURL := "https://discord.com/api/v10/guilds/" + os.Getenv("GUILD_ID") + "/members/" + user.DiscordId
+	err = json.Unmarshal(body, &rateLimit)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal rate limit response: %w", err)
+	}
 
-	memberData := DiscordMember{
-		Roles: []DiscordRole{StatusToDiscordRole(user.Status)},
+	return &RateLimitError{
+		RetryAfter: time.Duration(rateLimit.RetryAfter * float64(time.Second)),
+		Global:     rateLimit.Global,
 	}
+}
 
-	jsonData, err := json.Marshal(memberData)
+// Builds an error describing an unexpected discord response
+func unexpectedResponse(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+}
+
+// Fetches the member's current roles and nickname in the guild
+func fetchGuildMember(user *models.User) (*guildMember, error) {
+
+	resp, err := API().Request("GET", "/guilds/"+os.Getenv("GUILD_ID")+"/members/"+user.DiscordId, nil)
 	if err != nil {
-		fmt.Printf("Failed to marshal JSON data (guildInteractions.UpdateGuildUserRole): %s\n", err)
-		return false
+		return nil, fmt.Errorf("failed to fetch guild member: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, parseRateLimit(resp)
+	} else if resp.StatusCode != 200 {
+		return nil, unexpectedResponse(resp)
+	}
+
+	var member guildMember
+	if err := json.NewDecoder(resp.Body).Decode(&member); err != nil {
+		return nil, fmt.Errorf("failed to decode guild member: %w", err)
+	}
+
+	return &member, nil
+}
+
+// UpdateGuildUserRole syncs the member's roles with their status and their nickname with their name
+func UpdateGuildUserRole(user *models.User) error {
+
+	type DiscordMember struct {
+		Roles *[]DiscordRole `json:"roles,omitempty"`
+		Nick  *string        `json:"nick,omitempty"`
 	}
 
-	req, err := http.NewRequest("PATCH", baseURL, bytes.NewBuffer(jsonData))
+	memberPath := "/guilds/" + os.Getenv("GUILD_ID") + "/members/" + user.DiscordId
+
+	// Only replace roles managed by the backend, keeping manually granted roles such as Mentor or Sponsor
+	member, err := fetchGuildMember(user)
 	if err != nil {
-		fmt.Printf("error forming request (guildInteractions.UpdateGuildUserRole): %s", err)
-		return false
+		return fmt.Errorf("(guildInteractions.UpdateGuildUserRole) failed to fetch current roles: %w", err)
+	}
+
+	roles, added, removed := MergeManagedRoles(member.Roles, UserDiscordRoles(user), UserManagedDiscordRoles(user))
+	nickname, nicknameChanged := desiredNickname(user, member.Nick)
+
+	if len(added) == 0 && len(removed) == 0 && !nicknameChanged {
+		fmt.Printf("(guildInteractions.UpdateGuildUserRole) Roles already up to date for %s\n", user.DiscordId)
+		return nil
+	}
+
+	memberData := DiscordMember{}
+
+	if len(added) > 0 || len(removed) > 0 {
+		fmt.Printf("(guildInteractions.UpdateGuildUserRole) Updating roles for %s: added %v, removed %v\n", user.DiscordId, added, removed)
+		memberData.Roles = &roles
+	}
+
+	if nicknameChanged {
+		fmt.Printf("(guildInteractions.UpdateGuildUserRole) Updating nickname for %s: %q\n", user.DiscordId, nickname)
+		memberData.Nick = &nickname
 	}
-	req.Header.Set("Authorization", "Bot "+os.Getenv("BOT_TOKEN"))
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := API().Request("PATCH", memberPath, memberData)
 	if err != nil {
-		fmt.Printf("Failed to update users role on discord server: %s", err)
-		return false
+		return fmt.Errorf("(guildInteractions.UpdateGuildUserRole) failed to update users role on discord server: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 200 {
-		return true
-	} else if resp.StatusCode == 429 && retry == false {
-		var rateLimit RateLimitResponse
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Printf("Failed to read response body: %s", err)
-			return false
-		}
-
-		err = json.Unmarshal(body, &rateLimit)
-		if err != nil {
-			fmt.Printf("Failed to unmarshal rate limit response: %s", err)
-			return false
-		}
-		retryAfter := time.Duration(rateLimit.RetryAfter * float64(time.Second))
-		fmt.Printf("(guildInteractions.UpdateGuildUserRole) Rate limited. Retrying after %v seconds...\n", retryAfter)
-		go time.AfterFunc(retryAfter, func() {
-			UpdateGuildUserRole(user, true)
-		})
-	}
-
-	return false
+		return nil
+	} else if resp.StatusCode == 429 {
+		return parseRateLimit(resp)
+	}
 
+	return fmt.Errorf("(guildInteractions.UpdateGuildUserRole) %w", unexpectedResponse(resp))
 }
 
-func AddToDiscord(user *models.User, retry bool) bool {
+func AddToDiscord(user *models.User) error {
 
 	type DiscordMember struct {
 		AccessToken string        `json:"access_token"`
 		Roles       []DiscordRole `json:"roles"`
+		Nick        string        `json:"nick,omitempty"`
 	}
 
-	baseURL := "https://discord.com/api/v10/guilds/" + os.Getenv("GUILD_ID") + "/members/" + user.DiscordId
+	// Joins can be retried long after login, so the access token may need refreshing first
+	if err := EnsureFreshToken(user); err != nil {
+		return fmt.Errorf("(guildInteractions.AddToDiscord) failed to refresh access token: %w", err)
+	}
 
 	memberData := DiscordMember{
 		AccessToken: user.AuthToken,
-		Roles:       []DiscordRole{StatusToDiscordRole(user.Status)},
+		Roles:       UserDiscordRoles(user),
 	}
 
-	jsonData, err := json.Marshal(memberData)
-	if err != nil {
-		fmt.Printf("Failed to marshal JSON data (guildInteractions.AddToDiscord): %s\n", err)
-		return false
+	if nickname, ok := FormatNickname(user); ok && !user.NicknameOptOut {
+		memberData.Nick = nickname
 	}
 
-	req, err := http.NewRequest("PUT", baseURL, bytes.NewBuffer(jsonData))
+	resp, err := API().Request("PUT", "/guilds/"+os.Getenv("GUILD_ID")+"/members/"+user.DiscordId, memberData)
 	if err != nil {
-		fmt.Printf("error forming request (guildInteractions.AddToDiscord): %s", err)
-		return false
-	}
-	req.Header.Set("Authorization", "Bot "+os.Getenv("BOT_TOKEN"))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Printf("failed to add user to DeerHacks server: %s", err)
-		return false
+		return fmt.Errorf("(guildInteractions.AddToDiscord) failed to add user to DeerHacks server: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 201 {
-		return true
+		return nil
 	} else if resp.StatusCode == 204 {
-		EnqueueUser(user, "update")
-		return true
-	} else if resp.StatusCode == 429 && retry == false {
-		var rateLimit RateLimitResponse
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Printf("Failed to read response body: %s", err)
-			return false
-		}
-
-		err = json.Unmarshal(body, &rateLimit)
-		if err != nil {
-			fmt.Printf("Failed to unmarshal rate limit response: %s", err)
-			return false
-		}
-		retryAfter := time.Duration(rateLimit.RetryAfter * float64(time.Second))
-		fmt.Printf("(guildInteractions.UpdateGuildUserRole) Rate limited. Retrying after %v seconds...\n", retryAfter)
-		go time.AfterFunc(retryAfter, func() {
-			AddToDiscord(user, true)
-		})
-	}
-
-	return false
+		// Already a member, so sync their roles instead
+		return EnqueueUser(user, "update")
+	} else if resp.StatusCode == 429 {
+		return parseRateLimit(resp)
+	}
 
+	return fmt.Errorf("(guildInteractions.AddToDiscord) %w", unexpectedResponse(resp))
 }
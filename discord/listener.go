@@ -0,0 +1,88 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/utmmcss/deerhacks-backend/initializers"
+)
+
+// Postgres channel notified with the event of an enqueued item, or roleMappingEvent when the role mapping changes
+const queueNotifyChannel = "discord_queue"
+
+// How long to wait before reconnecting after the listen connection fails
+const listenReconnectDelay = 10 * time.Second
+
+// Wakes a queue task early. Buffered so a burst of notifications coalesces into a single drain.
+var queueWakeups = map[string]chan struct{}{
+	"join":   make(chan struct{}, 1),
+	"update": make(chan struct{}, 1),
+	"notify": make(chan struct{}, 1),
+	"team":   make(chan struct{}, 1),
+}
+
+// Wakes the task for the event without blocking, if a wake up is not already pending
+func wakeQueue(event string) {
+	wakeup, ok := queueWakeups[event]
+	if !ok {
+		return
+	}
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Notifies every listening replica that an item was enqueued. Items are still claimed with
+// FOR UPDATE SKIP LOCKED, so replicas that wake at the same time never process the same item.
+func notifyQueue(event string) {
+	if err := initializers.DB.Exec("SELECT pg_notify(?, ?)", queueNotifyChannel, event).Error; err != nil {
+		fmt.Printf("Failed to notify queue (listener.notifyQueue): %s\n", err)
+	}
+}
+
+// ListenQueue listens for queue notifications on a dedicated connection and wakes the matching
+// queue task. It reconnects when the connection drops, with the task tickers as a fallback meanwhile.
+func ListenQueue(dsn string) {
+	for {
+		if err := listenQueue(dsn); err != nil {
+			fmt.Printf("ListenQueue - Listen connection failed, reconnecting in %v: %v\n", listenReconnectDelay, err)
+		}
+		time.Sleep(listenReconnectDelay)
+
+		// Catch up on anything enqueued, and any role mapping change, while disconnected
+		reloadRoleMapping()
+		for event := range queueWakeups {
+			wakeQueue(event)
+		}
+	}
+}
+
+func listenQueue(dsn string) error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+queueNotifyChannel); err != nil {
+		return err
+	}
+	fmt.Println("ListenQueue - Listening for discord queue notifications")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if notification.Payload == roleMappingEvent {
+			reloadRoleMapping()
+			continue
+		}
+		wakeQueue(notification.Payload)
+	}
+}
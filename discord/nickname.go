@@ -0,0 +1,112 @@
+package discord
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+// Used when DISCORD_NICKNAME_FORMAT is not set, e.g. "Jane D. | Hacker"
+const defaultNicknameFormat = "{first} {last_initial}. | {role}"
+
+// Discord rejects nicknames longer than 32 characters
+const maxNicknameLength = 32
+
+// Label for {role} by status, with Hacker for every other status
+var nicknameRoleLabels = map[models.Status]string{
+	models.Admin:     "Organizer",
+	models.Moderator: "Organizer",
+	models.Volunteer: "Volunteer",
+	models.Guest:     "Guest",
+	models.Sponsor:   "Sponsor",
+}
+
+// Reads the nickname format from DISCORD_NICKNAME_FORMAT. Setting it to "off" disables nickname sync.
+func nicknameFormat() string {
+	format := os.Getenv("DISCORD_NICKNAME_FORMAT")
+	if format == "" {
+		return defaultNicknameFormat
+	}
+	if format == "off" {
+		return ""
+	}
+	return format
+}
+
+func firstRune(s string) string {
+	r, _ := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return ""
+	}
+	return strings.ToUpper(string(r))
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// FormatNickname builds the user's nickname from the configured format. Supported placeholders are
+// {first}, {last}, {last_initial}, {username} and {role}. It returns false when nickname sync is
+// disabled or the user has not registered a first name yet.
+func FormatNickname(user *models.User) (string, bool) {
+	format := nicknameFormat()
+	first := strings.TrimSpace(user.FirstName)
+	last := strings.TrimSpace(user.LastName)
+
+	if format == "" || first == "" {
+		return "", false
+	}
+
+	role, ok := nicknameRoleLabels[user.Status]
+	if !ok {
+		role = "Hacker"
+	}
+
+	nickname := strings.NewReplacer(
+		"{first}", first,
+		"{last}", last,
+		"{last_initial}", firstRune(last),
+		"{username}", user.Username,
+		"{role}", role,
+	).Replace(format)
+
+	// Tidy up the format when the user has no last name, e.g. "Jane . | Hacker"
+	if last == "" {
+		nickname = strings.ReplaceAll(nickname, " .", "")
+	}
+	nickname = strings.Join(strings.Fields(nickname), " ")
+
+	if utf8.RuneCountInString(nickname) > maxNicknameLength {
+		// Shorten the first name so the rest of the format, such as the role, still fits
+		overflow := utf8.RuneCountInString(nickname) - maxNicknameLength
+		if keep := utf8.RuneCountInString(first) - overflow; keep > 0 && strings.Contains(format, "{first}") {
+			nickname = strings.Replace(nickname, first, truncateRunes(first, keep), 1)
+		}
+		nickname = truncateRunes(nickname, maxNicknameLength)
+	}
+
+	return nickname, true
+}
+
+// Returns the nickname the member should have, and whether it needs changing from current.
+// Opted out users keep their own nickname, unless it is still the one the backend set.
+func desiredNickname(user *models.User, current string) (string, bool) {
+	nickname, ok := FormatNickname(user)
+
+	if user.NicknameOptOut {
+		if ok && current == nickname {
+			return "", true
+		}
+		return current, false
+	}
+
+	if !ok {
+		return current, false
+	}
+	return nickname, nickname != current
+}
@@ -0,0 +1,281 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+// Notification kinds
+const (
+	NotificationDM      = "dm"      // Bot DM to the user
+	NotificationWebhook = "webhook" // Post to the staff channel webhook
+)
+
+// Discord rejects messages longer than 2000 characters
+const maxMessageLength = 2000
+
+// Default notification templates, rendered with text/template. DM templates get the user,
+// staff templates get the data passed to NotifyStaff.
+var defaultNotificationTemplates = map[string]string{
+	"selected":      "Deer {{.Name}}, you have been selected to attend DeerHacks! 🦌 Check your email to RSVP and confirm your spot.",
+	"accepted":      "Deer {{.Name}}, your spot at DeerHacks is confirmed! We can't wait to see you there. 🦌",
+	"checked_in":    "Welcome to DeerHacks, {{.Name}}! You're checked in. Happy Hacking! 🦌",
+	"batch_summary": "**{{.Actor}}** updated {{.Count}} user(s){{range $status, $count := .Statuses}}, {{$count}} to {{$status}}{{end}}",
+	"error":         "⚠️ **{{.Context}}**: {{.Error}}",
+}
+
+// Template to DM when a user moves to a status
+var statusNotificationTemplates = map[models.Status]string{
+	models.Selected: "selected",
+	models.Accepted: "accepted",
+	models.Attended: "checked_in",
+}
+
+var (
+	notificationTemplates     map[string]*template.Template
+	notificationTemplatesOnce sync.Once
+)
+
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// Parses the default templates along with any overrides from the JSON object in DISCORD_NOTIFICATION_TEMPLATES
+func getNotificationTemplates() map[string]*template.Template {
+	notificationTemplatesOnce.Do(func() {
+		sources := make(map[string]string)
+		for name, source := range defaultNotificationTemplates {
+			sources[name] = source
+		}
+
+		if raw := os.Getenv("DISCORD_NOTIFICATION_TEMPLATES"); raw != "" {
+			var overrides map[string]string
+			if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+				fmt.Printf("Failed to parse DISCORD_NOTIFICATION_TEMPLATES, using defaults (notifications.getNotificationTemplates): %s\n", err)
+			}
+			for name, source := range overrides {
+				sources[name] = source
+			}
+		}
+
+		notificationTemplates = make(map[string]*template.Template)
+		for name, source := range sources {
+			tmpl, err := template.New(name).Parse(source)
+			if err != nil {
+				fmt.Printf("Failed to parse notification template %s (notifications.getNotificationTemplates): %s\n", name, err)
+				continue
+			}
+			notificationTemplates[name] = tmpl
+		}
+	})
+	return notificationTemplates
+}
+
+func renderNotification(name string, data interface{}) (string, error) {
+	tmpl, ok := getNotificationTemplates()[name]
+	if !ok {
+		return "", fmt.Errorf("notification template %s not found", name)
+	}
+
+	var content strings.Builder
+	if err := tmpl.Execute(&content, data); err != nil {
+		return "", fmt.Errorf("error rendering notification template %s: %w", name, err)
+	}
+
+	return truncateRunes(content.String(), maxMessageLength), nil
+}
+
+func enqueueNotification(kind string, discordId string, content string) error {
+	notification := models.DiscordNotification{
+		Kind:          kind,
+		DiscordId:     discordId,
+		Content:       content,
+		NextAttemptAt: time.Now(),
+	}
+	if err := initializers.DB.Create(&notification).Error; err != nil {
+		return err
+	}
+
+	notifyQueue("notify")
+	return nil
+}
+
+// NotifyStatusChange DMs the user about their new status, if it has a notification and DISCORD_DM_NOTIFICATIONS is enabled
+func NotifyStatusChange(user *models.User) {
+	name, ok := statusNotificationTemplates[user.Status]
+	if !ok || os.Getenv("DISCORD_DM_NOTIFICATIONS") != "true" {
+		return
+	}
+
+	data := struct {
+		*models.User
+		Name string
+	}{user, user.FirstName}
+	if data.Name == "" {
+		data.Name = user.Username
+	}
+
+	content, err := renderNotification(name, data)
+	if err != nil {
+		fmt.Printf("Failed to render notification (notifications.NotifyStatusChange): %s\n", err)
+		return
+	}
+
+	if err := enqueueNotification(NotificationDM, user.DiscordId, content); err != nil {
+		fmt.Printf("Failed to enqueue notification (notifications.NotifyStatusChange): %s\n", err)
+	}
+}
+
+// NotifyStaff posts a templated message to the staff channel, if DISCORD_STAFF_WEBHOOK_URL is set
+func NotifyStaff(name string, data interface{}) {
+	if os.Getenv("DISCORD_STAFF_WEBHOOK_URL") == "" {
+		return
+	}
+
+	content, err := renderNotification(name, data)
+	if err != nil {
+		fmt.Printf("Failed to render notification (notifications.NotifyStaff): %s\n", err)
+		return
+	}
+
+	if err := enqueueNotification(NotificationWebhook, "", content); err != nil {
+		fmt.Printf("Failed to enqueue notification (notifications.NotifyStaff): %s\n", err)
+	}
+}
+
+// NotifyStaffError posts an error to the staff channel
+func NotifyStaffError(context string, err error) {
+	NotifyStaff("error", map[string]string{
+		"Context": context,
+		"Error":   err.Error(),
+	})
+}
+
+func sendDM(discordId string, content string) error {
+	resp, err := API().Request("POST", "/users/@me/channels", map[string]string{"recipient_id": discordId})
+	if err != nil {
+		return fmt.Errorf("failed to open DM channel: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return parseRateLimit(resp)
+	} else if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to open DM channel: %w", unexpectedResponse(resp))
+	}
+
+	var channel struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&channel); err != nil {
+		return fmt.Errorf("failed to decode DM channel: %w", err)
+	}
+
+	msgResp, err := API().Request("POST", "/channels/"+channel.ID+"/messages", map[string]string{"content": content})
+	if err != nil {
+		return fmt.Errorf("failed to send DM: %w", err)
+	}
+	defer msgResp.Body.Close()
+
+	if msgResp.StatusCode == 429 {
+		return parseRateLimit(msgResp)
+	} else if msgResp.StatusCode != 200 {
+		return fmt.Errorf("failed to send DM: %w", unexpectedResponse(msgResp))
+	}
+
+	return nil
+}
+
+func sendWebhook(content string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"content":          content,
+		"allowed_mentions": map[string][]string{"parse": {}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON data: %w", err)
+	}
+
+	resp, err := webhookClient.Post(os.Getenv("DISCORD_STAFF_WEBHOOK_URL"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return parseRateLimit(resp)
+	} else if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		return fmt.Errorf("failed to post to webhook: %w", unexpectedResponse(resp))
+	}
+
+	return nil
+}
+
+// SendNotification delivers a queued notification
+func SendNotification(notification *models.DiscordNotification) error {
+	switch notification.Kind {
+	case NotificationDM:
+		return sendDM(notification.DiscordId, notification.Content)
+	case NotificationWebhook:
+		if os.Getenv("DISCORD_STAFF_WEBHOOK_URL") == "" {
+			return nil
+		}
+		return sendWebhook(notification.Content)
+	default:
+		return fmt.Errorf("invalid notification kind %s", notification.Kind)
+	}
+}
+
+var notificationQueue = &leaseQueue{
+	Event:   "notify",
+	Table:   models.DiscordNotification{}.TableName(),
+	Key:     "id",
+	Subject: "notification",
+	Process: func(item queueItem) error {
+		var notification models.DiscordNotification
+		if err := initializers.DB.Limit(1).Find(&notification, item.ID).Error; err != nil {
+			return err
+		}
+		if notification.ID == 0 {
+			return nil
+		}
+		return SendNotification(&notification)
+	},
+	DeadLetter: func(item queueItem) models.DiscordDeadLetter {
+		var notification models.DiscordNotification
+		initializers.DB.Limit(1).Find(&notification, item.ID)
+
+		payload, _ := json.Marshal(map[string]string{
+			"kind":    notification.Kind,
+			"content": notification.Content,
+		})
+		return models.DiscordDeadLetter{
+			DiscordId: notification.DiscordId,
+			Event:     "notify",
+			Payload:   string(payload),
+		}
+	},
+	// Failed staff posts are not posted to the staff channel, which would queue another post
+	NotifyStaff: false,
+}
+
+// Puts a dead lettered notification back on the queue from its payload
+func requeueNotification(deadLetter *models.DiscordDeadLetter) error {
+	var payload struct {
+		Kind    string `json:"kind"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(deadLetter.Payload), &payload); err != nil {
+		return errors.New("invalid notification payload")
+	}
+
+	return enqueueNotification(payload.Kind, deadLetter.DiscordId, payload.Content)
+}
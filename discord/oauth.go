@@ -0,0 +1,171 @@
+package discord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tokens expiring within this window are refreshed before they are used to join the guild
+const tokenRefreshMargin = 10 * time.Minute
+
+// ErrTokenRevoked is returned when the user's refresh token is no longer valid, so only logging in again can fix it
+var ErrTokenRevoked = errors.New("discord refresh token revoked")
+
+var oauthClient = &http.Client{Timeout: 30 * time.Second}
+
+// Reports whether the user's access token expires within margin. Unparseable expiries count as expired.
+func tokenExpiresWithin(user *models.User, margin time.Duration) bool {
+	expiry, err := time.Parse(time.RFC3339, user.TokenExpiry)
+	if err != nil {
+		return true
+	}
+	return time.Until(expiry) < margin
+}
+
+// Exchanges the refresh token for new tokens, returning ErrTokenRevoked if Discord rejects it
+func requestTokenRefresh(refreshToken string) (*models.DiscordDetails, error) {
+	data := url.Values{}
+	data.Set("client_id", os.Getenv("CLIENT_ID"))
+	data.Set("client_secret", os.Getenv("CLIENT_SECRET"))
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+
+	resp, err := oauthClient.PostForm(apiBaseURL()+"/oauth2/token", data)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to Discord token API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, parseRateLimit(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	var appError models.DiscordError
+	json.Unmarshal(body, &appError)
+	if appError.Error == "invalid_grant" {
+		return nil, ErrTokenRevoked
+	} else if appError.Error != "" {
+		return nil, fmt.Errorf("API Error: %s - %s", appError.Error, appError.ErrorDescription)
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var details models.DiscordDetails
+	if err := json.Unmarshal(body, &details); err != nil {
+		return nil, fmt.Errorf("error unmarshalling response: %w", err)
+	}
+	return &details, nil
+}
+
+// RefreshUserToken exchanges the user's refresh token for new tokens and saves them.
+// A rejected refresh token flags the user as revoked and returns ErrTokenRevoked.
+//
+// Discord rotates the refresh token on every refresh, so the user row is locked for the exchange. A replica
+// that waited on the lock finds the tokens another replica saved and uses them instead of refreshing again.
+func RefreshUserToken(user *models.User) error {
+	revoked := false
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var stored models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stored, user.ID).Error; err != nil {
+			return fmt.Errorf("error locking user: %w", err)
+		}
+
+		// Another replica refreshed the tokens, or the user logged in again, while this one read the old ones
+		if stored.TokenRevoked || stored.RefreshToken == "" || stored.RefreshToken != user.RefreshToken {
+			user.AuthToken = stored.AuthToken
+			user.RefreshToken = stored.RefreshToken
+			user.TokenExpiry = stored.TokenExpiry
+			user.TokenRevoked = stored.TokenRevoked
+			revoked = stored.TokenRevoked || stored.RefreshToken == ""
+			return nil
+		}
+
+		details, err := requestTokenRefresh(stored.RefreshToken)
+		if errors.Is(err, ErrTokenRevoked) {
+			// Only flag the rejected token, never one saved since it was read
+			result := tx.Model(&models.User{}).Where("id = ? AND refresh_token = ?", stored.ID, stored.RefreshToken).Update("token_revoked", true)
+			if result.Error != nil {
+				return fmt.Errorf("error flagging revoked token: %w", result.Error)
+			}
+			if result.RowsAffected > 0 {
+				user.TokenRevoked = true
+				revoked = true
+				fmt.Printf("(oauth.RefreshUserToken) Refresh token revoked for %s\n", user.DiscordId)
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		user.AuthToken = details.AccessToken
+		user.RefreshToken = details.RefreshToken
+		user.TokenExpiry = time.Now().Add(time.Duration(details.ExpiresIn) * time.Second).Format(time.RFC3339)
+		user.TokenRevoked = false
+
+		return tx.Model(user).Select("auth_token", "refresh_token", "token_expiry", "token_revoked").Updates(user).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// EnsureFreshToken refreshes the user's access token if it is about to expire
+func EnsureFreshToken(user *models.User) error {
+	if user.TokenRevoked {
+		return ErrTokenRevoked
+	}
+	if !tokenExpiresWithin(user, tokenRefreshMargin) {
+		return nil
+	}
+	return RefreshUserToken(user)
+}
+
+// RefreshExpiringTokens refreshes the tokens expiring within window for users waiting in the join queue,
+// so their tokens stay usable for joins that are retried long after they logged in.
+func RefreshExpiringTokens(window time.Duration) {
+	var users []models.User
+	joinQueue := initializers.DB.Model(&models.JoinGuildQueue{}).Select("discord_id")
+	if err := initializers.DB.Where("token_revoked = ? AND refresh_token <> '' AND discord_id IN (?)", false, joinQueue).Find(&users).Error; err != nil {
+		fmt.Printf("Failed to fetch users (oauth.RefreshExpiringTokens): %s\n", err)
+		return
+	}
+
+	refreshed, revoked := 0, 0
+	for i := range users {
+		if !tokenExpiresWithin(&users[i], window) {
+			continue
+		}
+		err := RefreshUserToken(&users[i])
+		if errors.Is(err, ErrTokenRevoked) {
+			revoked++
+		} else if err != nil {
+			fmt.Printf("Failed to refresh token for %s (oauth.RefreshExpiringTokens): %s\n", users[i].DiscordId, err)
+		} else {
+			refreshed++
+		}
+	}
+
+	fmt.Printf("(oauth.RefreshExpiringTokens) Refreshed %d tokens, %d revoked\n", refreshed, revoked)
+}
@@ -1,83 +1,285 @@
 package discord
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/utmmcss/deerhacks-backend/initializers"
 	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func DequeueUsers(event string) ([]*models.User, error) {
-	// Dequeues 25 users at a time
-	var sqlQuery string
-	var discordIDs []string
-	var users []*models.User
+// How long a dequeued item stays hidden from other workers while it is being processed
+const queueLease = 10 * time.Minute
 
-	switch event {
-	case "join":
-		sqlQuery = `SELECT discord_id FROM join_guild_queue ORDER BY created_at ASC LIMIT 25 FOR UPDATE SKIP LOCKED`
-	case "update":
-		sqlQuery = `SELECT discord_id FROM update_role_queue ORDER BY created_at ASC LIMIT 25 FOR UPDATE SKIP LOCKED`
-	default:
-		return nil, fmt.Errorf("invalid event type")
+// Retry backoff is queueBaseBackoff * 2^(attempts - 1), capped at queueMaxBackoff
+const (
+	queueBaseBackoff = time.Minute
+	queueMaxBackoff  = time.Hour
+)
+
+// Number of attempts before an item is moved to the dead letter table, overridable with DISCORD_QUEUE_MAX_ATTEMPTS
+const defaultQueueMaxAttempts = 5
+
+func queueMaxAttempts() int {
+	if maxAttempts, err := strconv.Atoi(os.Getenv("DISCORD_QUEUE_MAX_ATTEMPTS")); err == nil && maxAttempts > 0 {
+		return maxAttempts
 	}
+	return defaultQueueMaxAttempts
+}
 
-	// Begin transaction
-	tx := initializers.DB.Begin()
+func queueBackoff(attempts int, err error) time.Duration {
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.RetryAfter
+	}
 
-	// Select the next 25 items and lock them
-	if err := tx.Raw(sqlQuery).Scan(&discordIDs).Error; err != nil {
-		tx.Rollback()
-		return nil, err
+	backoff := time.Duration(float64(queueBaseBackoff) * math.Pow(2, float64(attempts-1)))
+	if backoff > queueMaxBackoff {
+		return queueMaxBackoff
 	}
+	return backoff
+}
+
+// A claimed queue item. Key is what the item refers to, such as a discord id or a team id.
+// Lease is the next_attempt_at the item was leased until. Enqueueing the item again changes it, so a
+// worker only completes or fails an item while it still holds the lease, and a request made while the
+// item was being processed is never lost.
+type queueItem struct {
+	ID       uint
+	Key      string
+	Attempts int
+	Lease    time.Time
+}
 
-	// Delete the items
-	if event == "join" {
-		if err := tx.Where("discord_id IN ?", discordIDs).Unscoped().Delete(&models.JoinGuildQueue{}).Error; err != nil {
-			tx.Rollback()
-			return nil, err
+// A discord work queue table. Items are claimed with FOR UPDATE SKIP LOCKED and leased rather than
+// deleted, retried with backoff when processing fails, and moved to the dead letter table once they
+// have used all of their attempts.
+type leaseQueue struct {
+	Event   string // Queue event, used for wake ups and dead letters
+	Table   string
+	Key     string // Column holding what an item refers to
+	Subject string // What an item refers to, for logs
+
+	// Processes a claimed item. Items whose subject no longer exists should succeed so they are dropped.
+	Process func(item queueItem) error
+	// Builds the dead letter for an item that used all of its attempts, with what is needed to requeue it
+	DeadLetter func(item queueItem) models.DiscordDeadLetter
+	// Posts dead lettered items to the staff channel, off for the queue that delivers those posts
+	NotifyStaff bool
+}
+
+// Processes user queue items with process, dropping items for users that no longer exist
+func userQueueProcess(process func(user *models.User) error) func(item queueItem) error {
+	return func(item queueItem) error {
+		var user models.User
+		if err := initializers.DB.Where("discord_id = ?", item.Key).Limit(1).Find(&user).Error; err != nil {
+			return err
 		}
-	} else {
-		if err := tx.Where("discord_id IN ?", discordIDs).Unscoped().Delete(&models.UpdateRoleQueue{}).Error; err != nil {
-			tx.Rollback()
-			return nil, err
+		if user.ID == 0 {
+			return nil
 		}
+		return process(&user)
 	}
+}
+
+func userDeadLetter(event string) func(item queueItem) models.DiscordDeadLetter {
+	return func(item queueItem) models.DiscordDeadLetter {
+		return models.DiscordDeadLetter{DiscordId: item.Key, Event: event}
+	}
+}
+
+var joinQueue = &leaseQueue{
+	Event:       "join",
+	Table:       models.JoinGuildQueue{}.TableName(),
+	Key:         "discord_id",
+	Subject:     "user",
+	Process:     userQueueProcess(AddToDiscord),
+	DeadLetter:  userDeadLetter("join"),
+	NotifyStaff: true,
+}
+
+var updateQueue = &leaseQueue{
+	Event:       "update",
+	Table:       models.UpdateRoleQueue{}.TableName(),
+	Key:         "discord_id",
+	Subject:     "user",
+	Process:     userQueueProcess(UpdateGuildUserRole),
+	DeadLetter:  userDeadLetter("update"),
+	NotifyStaff: true,
+}
 
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
+// Claims up to 25 due items, oldest first, leasing them so other workers skip them until they are
+// completed or failed
+func (q *leaseQueue) dequeue() ([]queueItem, error) {
+	var items []queueItem
+
+	sqlQuery := `UPDATE ` + q.Table + ` SET next_attempt_at = ? WHERE id IN (
+		SELECT id FROM ` + q.Table + ` WHERE deleted_at IS NULL AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+		ORDER BY created_at ASC LIMIT 25 FOR UPDATE SKIP LOCKED
+	) RETURNING id, ` + q.Key + `::text AS key, attempts, next_attempt_at AS lease`
+
+	if err := initializers.DB.Raw(sqlQuery, time.Now().Add(queueLease), time.Now()).Scan(&items).Error; err != nil {
 		return nil, err
 	}
 
-	// Find Users
-	if len(discordIDs) > 0 {
-		if err := initializers.DB.Where("discord_id IN ?", discordIDs).Find(&users).Error; err != nil {
-			return nil, err
+	// RETURNING does not keep the order of the claim
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// Removes a successfully processed item from the queue, unless it was enqueued again meanwhile
+func (q *leaseQueue) complete(item queueItem) error {
+	return initializers.DB.Exec(`DELETE FROM `+q.Table+` WHERE id = ? AND next_attempt_at = ?`, item.ID, item.Lease).Error
+}
+
+// Records a failed attempt and schedules a retry with backoff, or moves the item to the dead letter
+// table once it has used all of its attempts. Items enqueued again meanwhile are left as they are, to
+// be processed with fresh attempts.
+func (q *leaseQueue) fail(item queueItem, cause error) error {
+	lastError := cause.Error()
+	if len(lastError) > 1000 {
+		lastError = lastError[:1000]
+	}
+
+	attempts := item.Attempts + 1
+
+	// Retrying cannot help once the user's token is revoked, they need to log in again
+	if attempts >= queueMaxAttempts() || errors.Is(cause, ErrTokenRevoked) {
+		deadLetter := q.DeadLetter(item)
+		deadLetter.Attempts = attempts
+		deadLetter.LastError = lastError
+
+		leased := true
+		err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Exec(`DELETE FROM `+q.Table+` WHERE id = ? AND next_attempt_at = ?`, item.ID, item.Lease)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				leased = false
+				return nil
+			}
+			return tx.Create(&deadLetter).Error
+		})
+		if err != nil || !leased {
+			return err
+		}
+
+		fmt.Printf("(queue.fail) Moved %s item for %s %s to dead letters after %d attempts: %s\n", q.Event, q.Subject, item.Key, attempts, lastError)
+		if q.NotifyStaff {
+			NotifyStaffError(fmt.Sprintf("Discord %s failed for %s %s", q.Event, q.Subject, item.Key), cause)
 		}
+		return nil
 	}
 
-	return users, nil
+	retryAfter := queueBackoff(attempts, cause)
+	fmt.Printf("(queue.fail) Attempt %d of %s item for %s %s failed, retrying after %v: %s\n", attempts, q.Event, q.Subject, item.Key, retryAfter, lastError)
+
+	return initializers.DB.Table(q.Table).Where("id = ? AND next_attempt_at = ?", item.ID, item.Lease).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": time.Now().Add(retryAfter),
+		"last_error":      lastError,
+	}).Error
 }
 
+// Processes the queue until it has no more due items
+func (q *leaseQueue) drain(taskName string) {
+	for {
+		items, err := q.dequeue()
+		if err != nil {
+			fmt.Printf("%s - Error dequeuing items: %v\n", taskName, err)
+			return
+		}
+
+		if len(items) == 0 {
+			return
+		}
+
+		for _, item := range items {
+			fmt.Printf("%s - Processing %s %s\n", taskName, q.Subject, item.Key)
+			if err := q.Process(item); err != nil {
+				if err := q.fail(item, err); err != nil {
+					fmt.Printf("%s - Error failing %s %s: %v\n", taskName, q.Subject, item.Key, err)
+				}
+			} else if err := q.complete(item); err != nil {
+				fmt.Printf("%s - Error completing %s %s: %v\n", taskName, q.Subject, item.Key, err)
+			}
+		}
+	}
+}
+
+// EnqueueUser adds the user to the queue, or makes their existing item due immediately with fresh attempts
 func EnqueueUser(user *models.User, event string) error {
 	if user == nil {
 		return fmt.Errorf("nil user provided")
 	}
 
+	onConflict := clause.OnConflict{
+		Columns: []clause.Column{{Name: "discord_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"last_error":      "",
+		}),
+	}
+
 	switch event {
 	case "join":
-		joinQueueItem := models.JoinGuildQueue{DiscordId: user.DiscordId}
-		if err := initializers.DB.Create(&joinQueueItem).Error; err != nil {
+		joinQueueItem := models.JoinGuildQueue{DiscordId: user.DiscordId, NextAttemptAt: time.Now()}
+		if err := initializers.DB.Clauses(onConflict).Create(&joinQueueItem).Error; err != nil {
 			return err
 		}
 	case "update":
-		updateQueueItem := models.UpdateRoleQueue{DiscordId: user.DiscordId}
-		if err := initializers.DB.Create(&updateQueueItem).Error; err != nil {
+		updateQueueItem := models.UpdateRoleQueue{DiscordId: user.DiscordId, NextAttemptAt: time.Now()}
+		if err := initializers.DB.Clauses(onConflict).Create(&updateQueueItem).Error; err != nil {
 			return err
 		}
 	default:
 		return fmt.Errorf("invalid event type")
 	}
 
+	notifyQueue(event)
+
 	return nil
 }
+
+// RequeueDeadLetter puts a dead lettered item back on its queue
+func RequeueDeadLetter(deadLetter *models.DiscordDeadLetter) error {
+	if deadLetter.Event == "notify" {
+		if err := requeueNotification(deadLetter); err != nil {
+			return err
+		}
+		return initializers.DB.Unscoped().Delete(deadLetter).Error
+	}
+
+	if deadLetter.Event == "team" {
+		teamId, err := strconv.ParseUint(deadLetter.Payload, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid team payload")
+		}
+		if err := EnqueueTeam(uint(teamId)); err != nil {
+			return err
+		}
+		return initializers.DB.Unscoped().Delete(deadLetter).Error
+	}
+
+	var user models.User
+	initializers.DB.First(&user, "discord_id = ?", deadLetter.DiscordId)
+
+	if user.ID == 0 {
+		return fmt.Errorf("user %s not found", deadLetter.DiscordId)
+	}
+
+	if err := EnqueueUser(&user, deadLetter.Event); err != nil {
+		return err
+	}
+
+	return initializers.DB.Unscoped().Delete(deadLetter).Error
+}
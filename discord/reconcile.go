@@ -0,0 +1,218 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+// Discord returns at most 1000 members per page
+const guildMembersPageSize = 1000
+
+type guildMember struct {
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		Bot      bool   `json:"bot"`
+	} `json:"user"`
+	Nick  string        `json:"nick"`
+	Roles []DiscordRole `json:"roles"`
+}
+
+type RoleDrift struct {
+	DiscordId string        `json:"discord_id"`
+	Username  string        `json:"username"`
+	Status    models.Status `json:"status"`
+	Added     []DiscordRole `json:"added"`
+	Removed   []DiscordRole `json:"removed"`
+	Nickname  string        `json:"nickname,omitempty"` // Set when the nickname also needs changing
+}
+
+type UnknownMember struct {
+	DiscordId string        `json:"discord_id"`
+	Username  string        `json:"username"`
+	Roles     []DiscordRole `json:"roles"`
+}
+
+type MissingUser struct {
+	DiscordId string        `json:"discord_id"`
+	Username  string        `json:"username"`
+	Status    models.Status `json:"status"`
+}
+
+// ReconcileReport describes how the guild differs from the database
+type ReconcileReport struct {
+	DryRun         bool            `json:"dry_run"`
+	StartedAt      time.Time       `json:"started_at"`
+	CompletedAt    time.Time       `json:"completed_at"`
+	MembersScanned int             `json:"members_scanned"`
+	Drifted        []RoleDrift     `json:"drifted"`
+	Enqueued       int             `json:"enqueued"`
+	UnknownMembers []UnknownMember `json:"unknown_members"`
+	MissingUsers   []MissingUser   `json:"missing_users"`
+}
+
+// ErrReconcileRunning is returned when a reconciliation is already in progress on this instance
+var ErrReconcileRunning = fmt.Errorf("reconciliation already running")
+
+var reconcileMu sync.Mutex
+
+// Pages through every member of the guild
+func fetchGuildMembers() ([]guildMember, error) {
+	var members []guildMember
+	after := "0"
+
+	for {
+		query := url.Values{}
+		query.Set("limit", fmt.Sprint(guildMembersPageSize))
+		query.Set("after", after)
+
+		resp, err := API().Request("GET", "/guilds/"+os.Getenv("GUILD_ID")+"/members?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch guild members: %w", err)
+		}
+
+		if resp.StatusCode == 429 {
+			err := parseRateLimit(resp)
+			resp.Body.Close()
+			return nil, err
+		} else if resp.StatusCode != 200 {
+			err := unexpectedResponse(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page []guildMember
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode guild members: %w", err)
+		}
+
+		members = append(members, page...)
+
+		if len(page) < guildMembersPageSize {
+			return members, nil
+		}
+		after = page[len(page)-1].User.ID
+	}
+}
+
+// ReconcileGuild compares the roles of every guild member against the roles for their status,
+// enqueueing a role update for each member that has drifted. With dryRun nothing is enqueued.
+// Members not in the database and users not in the guild are only reported.
+func ReconcileGuild(dryRun bool) (*ReconcileReport, error) {
+	if !reconcileMu.TryLock() {
+		return nil, ErrReconcileRunning
+	}
+	defer reconcileMu.Unlock()
+
+	report := &ReconcileReport{
+		DryRun:         dryRun,
+		StartedAt:      time.Now(),
+		Drifted:        []RoleDrift{},
+		UnknownMembers: []UnknownMember{},
+		MissingUsers:   []MissingUser{},
+	}
+
+	members, err := fetchGuildMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := initializers.DB.Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("error fetching users: %w", err)
+	}
+
+	// Removed extra roles are fetched too, they are still managed for the user they were removed from
+	var extras []models.UserDiscordRole
+	if err := initializers.DB.Unscoped().Find(&extras).Error; err != nil {
+		return nil, fmt.Errorf("error fetching extra roles: %w", err)
+	}
+
+	usersById := make(map[string]*models.User)
+	for i := range users {
+		usersById[users[i].DiscordId] = &users[i]
+	}
+
+	extrasById := make(map[string][]models.UserDiscordRole)
+	allExtrasById := make(map[string][]models.UserDiscordRole)
+	for _, extra := range extras {
+		allExtrasById[extra.DiscordId] = append(allExtrasById[extra.DiscordId], extra)
+		if !extra.DeletedAt.Valid {
+			extrasById[extra.DiscordId] = append(extrasById[extra.DiscordId], extra)
+		}
+	}
+
+	managed := ManagedDiscordRoles()
+	inGuild := make(map[string]bool)
+
+	for _, member := range members {
+		if member.User.Bot {
+			continue
+		}
+		report.MembersScanned++
+		inGuild[member.User.ID] = true
+
+		user, ok := usersById[member.User.ID]
+		if !ok {
+			report.UnknownMembers = append(report.UnknownMembers, UnknownMember{
+				DiscordId: member.User.ID,
+				Username:  member.User.Username,
+				Roles:     member.Roles,
+			})
+			continue
+		}
+
+		desired := withExtraRoles(append([]DiscordRole{}, StatusToDiscordRoles(user.Status)...), extrasById[user.DiscordId])
+		_, added, removed := MergeManagedRoles(member.Roles, desired, withUserManagedRoles(managed, allExtrasById[user.DiscordId]))
+		nickname, nicknameChanged := desiredNickname(user, member.Nick)
+		if len(added) == 0 && len(removed) == 0 && !nicknameChanged {
+			continue
+		}
+		if !nicknameChanged {
+			nickname = ""
+		}
+
+		report.Drifted = append(report.Drifted, RoleDrift{
+			DiscordId: user.DiscordId,
+			Username:  user.Username,
+			Status:    user.Status,
+			Added:     added,
+			Removed:   removed,
+			Nickname:  nickname,
+		})
+
+		if !dryRun {
+			if err := EnqueueUser(user, "update"); err != nil {
+				fmt.Printf("Failed to enqueue role update for %s (reconcile.ReconcileGuild): %s\n", user.DiscordId, err)
+				continue
+			}
+			report.Enqueued++
+		}
+	}
+
+	for _, user := range users {
+		if !inGuild[user.DiscordId] {
+			report.MissingUsers = append(report.MissingUsers, MissingUser{
+				DiscordId: user.DiscordId,
+				Username:  user.Username,
+				Status:    user.Status,
+			})
+		}
+	}
+
+	report.CompletedAt = time.Now()
+
+	fmt.Printf("(reconcile.ReconcileGuild) Scanned %d members (dry run: %t): %d drifted, %d enqueued, %d not in database, %d users not in guild\n",
+		report.MembersScanned, dryRun, len(report.Drifted), report.Enqueued, len(report.UnknownMembers), len(report.MissingUsers))
+
+	return report, nil
+}
@@ -2,82 +2,81 @@ package discord
 
 import (
 	"fmt"
+	"os"
 	"time"
 )
 
+// Drains the queue when an item is enqueued, and every interval as a fallback for missed
+// notifications and items waiting on a retry
+func runQueueTask(queue *leaseQueue, taskName string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-queueWakeups[queue.Event]:
+		}
+
+		fmt.Println(taskName, "running", time.Now())
+
+		queue.drain(taskName)
+
+		fmt.Println(taskName, "completed", time.Now())
+	}
+}
+
+// JoinGuildTask adds queued users to the guild
 func JoinGuildTask(interval time.Duration) {
+	runQueueTask(joinQueue, "JoinGuildTask", interval)
+}
+
+// UpdateRoleTask syncs the roles and nicknames of queued users
+func UpdateRoleTask(interval time.Duration) {
+	runQueueTask(updateQueue, "UpdateRoleTask", interval)
+}
+
+// NotificationTask sends queued notifications
+func NotificationTask(interval time.Duration) {
+	runQueueTask(notificationQueue, "NotificationTask", interval)
+}
+
+// TeamChannelTask syncs the channels of queued teams
+func TeamChannelTask(interval time.Duration) {
+	runQueueTask(teamQueue, "TeamChannelTask", interval)
+}
+
+// ReconcileGuildTask periodically reconciles guild roles against the database.
+// Set DISCORD_RECONCILE_DRY_RUN=true to only log the drift without enqueueing fixes.
+func ReconcileGuildTask(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 
 	for {
 		select {
 		case <-ticker.C:
-			fmt.Println("Join Guild Task running", time.Now())
-
-			for {
-				// Call DequeueUsers
-				users, err := DequeueUsers("join")
-				if err != nil {
-					fmt.Printf("JoinGuildTask - Error dequeuing users: %v\n", err)
-					break // Exit the inner loop on error
-				}
-
-				// Check if the list is empty
-				if len(users) == 0 {
-					fmt.Println("JoinGuildTask - No more users to process. Waiting for the next interval.")
-					break // Exit the inner loop if no users are left to process
-				}
-
-				// Process the dequeued users
-				for _, user := range users {
-					if user != nil {
-						fmt.Printf("JoinGuildTask - Processing user with Discord ID: %s\n", user.DiscordId)
-						AddToDiscord(user, false)
-						// Sleep for 3 seconds before processing the next user
-						time.Sleep(3 * time.Second)
-					}
-				}
+			fmt.Println("Reconcile Guild Task running", time.Now())
+
+			if _, err := ReconcileGuild(os.Getenv("DISCORD_RECONCILE_DRY_RUN") == "true"); err != nil {
+				fmt.Printf("ReconcileGuildTask - Error reconciling guild: %v\n", err)
 			}
 
-			fmt.Println("Join Guild Task completed", time.Now())
+			fmt.Println("Reconcile Guild Task completed", time.Now())
 
 		}
 	}
 }
 
-func UpdateRoleTask(interval time.Duration) {
+// RefreshTokensTask periodically refreshes the discord tokens of users waiting to join the guild
+func RefreshTokensTask(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 
 	for {
 		select {
 		case <-ticker.C:
-			fmt.Println("Update Role Task running", time.Now())
-
-			for {
-				// Call DequeueUsers
-				users, err := DequeueUsers("update")
-				if err != nil {
-					fmt.Printf("UpdateRoleTask - Error dequeuing users: %v\n", err)
-					break // Exit the inner loop on error
-				}
-
-				// Check if the list is empty
-				if len(users) == 0 {
-					fmt.Println("UpdateRoleTask - No more users to process. Waiting for the next interval.")
-					break // Exit the inner loop if no users are left to process
-				}
-
-				// Process the dequeued users
-				for _, user := range users {
-					if user != nil {
-						fmt.Printf("UpdateRoleTask - Processing user with Discord ID: %s\n", user.DiscordId)
-						UpdateGuildUserRole(user, false)
-						// Sleep for 3 seconds before processing the next user
-						time.Sleep(3 * time.Second)
-					}
-				}
-			}
+			fmt.Println("Refresh Tokens Task running", time.Now())
+
+			RefreshExpiringTokens(2 * interval)
 
-			fmt.Println("Update Role Task completed", time.Now())
+			fmt.Println("Refresh Tokens Task completed", time.Now())
 
 		}
 	}
@@ -0,0 +1,263 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+type DiscordRole string
+
+// Roles in the DeerHacks guild, used when no role mapping is configured
+const (
+	PendingDiscord     DiscordRole = "1087192865186254999" // Pending Email Verification
+	RegisteringDiscord DiscordRole = "1087193230157819925" // Email Verified, Registering for DeerHacks
+	AppliedDiscord     DiscordRole = "1192983763995602964" // Application Submitted
+	SelectedDiscord    DiscordRole = "1192983889807933490" // Selected to Attend DeerHacks, Pending Confirmation
+	AcceptedDiscord    DiscordRole = "1192984014571704330" // Accepted to Attend DeerHacks
+	AttendedDiscord    DiscordRole = "1192984114987548722" // Signed in at DeerHacks
+	VolunteerDiscord   DiscordRole = "1100893133581070476" // Volunteer at DeerHacks
+	DefaultDiscord     DiscordRole = "1085682655326130316" // Status unknown
+)
+
+// Key in a role mapping for statuses without their own roles
+const DefaultRoleKey = "default"
+
+var defaultRoleMapping = map[string][]DiscordRole{
+	string(models.Pending):     {PendingDiscord},
+	string(models.Registering): {RegisteringDiscord},
+	string(models.Applied):     {AppliedDiscord},
+	string(models.Selected):    {SelectedDiscord},
+	string(models.Accepted):    {AcceptedDiscord},
+	string(models.Attended):    {AttendedDiscord},
+	string(models.Volunteer):   {VolunteerDiscord},
+	DefaultRoleKey:             {DefaultDiscord},
+}
+
+var (
+	roleMapping   map[string][]DiscordRole
+	roleMappingMu sync.RWMutex
+)
+
+// Reads the base role mapping from DISCORD_ROLE_MAP (JSON) or the file at DISCORD_ROLE_MAP_FILE,
+// e.g. {"accepted": ["<role id>"], "default": ["<role id>"]}
+func roleMappingFromConfig() (map[string][]DiscordRole, error) {
+	raw := []byte(os.Getenv("DISCORD_ROLE_MAP"))
+
+	if path := os.Getenv("DISCORD_ROLE_MAP_FILE"); len(raw) == 0 && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading DISCORD_ROLE_MAP_FILE: %w", err)
+		}
+		raw = data
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var mapping map[string][]DiscordRole
+	if err := json.Unmarshal(raw, &mapping); err != nil {
+		return nil, fmt.Errorf("error parsing discord role mapping: %w", err)
+	}
+	return mapping, nil
+}
+
+// LoadRoleMapping builds the status to roles mapping. Roles come from the config if set, otherwise
+// the built in DeerHacks guild roles, and any statuses in the discord_role_mappings table override them.
+func LoadRoleMapping() error {
+	mapping, err := roleMappingFromConfig()
+	if err != nil {
+		return err
+	}
+	if mapping == nil {
+		mapping = make(map[string][]DiscordRole)
+		for status, roles := range defaultRoleMapping {
+			mapping[status] = roles
+		}
+	}
+
+	var overrides []models.DiscordRoleMapping
+	if err := initializers.DB.Find(&overrides).Error; err != nil {
+		return fmt.Errorf("error fetching discord role mappings: %w", err)
+	}
+
+	overridden := make(map[string]bool)
+	for _, override := range overrides {
+		if !overridden[override.Status] {
+			mapping[override.Status] = []DiscordRole{}
+			overridden[override.Status] = true
+		}
+		mapping[override.Status] = append(mapping[override.Status], DiscordRole(override.RoleId))
+	}
+
+	roleMappingMu.Lock()
+	roleMapping = mapping
+	roleMappingMu.Unlock()
+
+	return nil
+}
+
+// Notified on the queue channel when an admin changes the role mapping, so every replica reloads it
+const roleMappingEvent = "roles"
+
+// NotifyRoleMappingChanged tells every listening replica to reload the role mapping
+func NotifyRoleMappingChanged() {
+	notifyQueue(roleMappingEvent)
+}
+
+func reloadRoleMapping() {
+	if err := LoadRoleMapping(); err != nil {
+		fmt.Printf("Failed to reload role mapping (roles.reloadRoleMapping): %s\n", err)
+	}
+}
+
+func getRoleMapping() map[string][]DiscordRole {
+	roleMappingMu.RLock()
+	mapping := roleMapping
+	roleMappingMu.RUnlock()
+
+	if mapping != nil {
+		return mapping
+	}
+
+	if err := LoadRoleMapping(); err != nil {
+		fmt.Printf("Failed to load role mapping, using default roles (roles.getRoleMapping): %s\n", err)
+		return defaultRoleMapping
+	}
+
+	roleMappingMu.RLock()
+	defer roleMappingMu.RUnlock()
+	return roleMapping
+}
+
+// RoleMapping returns a copy of the current status to roles mapping
+func RoleMapping() map[string][]DiscordRole {
+	mapping := make(map[string][]DiscordRole)
+	for status, roles := range getRoleMapping() {
+		mapping[status] = append([]DiscordRole{}, roles...)
+	}
+	return mapping
+}
+
+func StatusToDiscordRoles(s models.Status) []DiscordRole {
+	mapping := getRoleMapping()
+
+	if roles, ok := mapping[string(s)]; ok {
+		return roles
+	}
+	return mapping[DefaultRoleKey]
+}
+
+// UserDiscordRoles returns the roles for the user's status along with any extra roles granted to them
+func UserDiscordRoles(user *models.User) []DiscordRole {
+	roles := append([]DiscordRole{}, StatusToDiscordRoles(user.Status)...)
+
+	var extras []models.UserDiscordRole
+	if err := initializers.DB.Where("discord_id = ?", user.DiscordId).Find(&extras).Error; err != nil {
+		fmt.Printf("Failed to fetch extra roles (roles.UserDiscordRoles): %s\n", err)
+		return roles
+	}
+
+	return withExtraRoles(roles, extras)
+}
+
+// Appends the extra roles that are not already in roles
+func withExtraRoles(roles []DiscordRole, extras []models.UserDiscordRole) []DiscordRole {
+	seen := make(map[DiscordRole]bool)
+	for _, role := range roles {
+		seen[role] = true
+	}
+	for _, extra := range extras {
+		role := DiscordRole(extra.RoleId)
+		if !seen[role] {
+			roles = append(roles, role)
+			seen[role] = true
+		}
+	}
+
+	return roles
+}
+
+// ManagedDiscordRoles returns every role the status mapping assigns. Roles outside this set, and
+// outside the synced user's own extra roles, are never changed by a sync.
+func ManagedDiscordRoles() map[DiscordRole]bool {
+	managed := make(map[DiscordRole]bool)
+	for _, roles := range getRoleMapping() {
+		for _, role := range roles {
+			managed[role] = true
+		}
+	}
+
+	// Include replaced and removed mapped roles so they are taken away on the next sync
+	var mappedRoles []string
+	if err := initializers.DB.Unscoped().Model(&models.DiscordRoleMapping{}).Distinct().Pluck("role_id", &mappedRoles).Error; err != nil {
+		fmt.Printf("Failed to fetch mapped roles (roles.ManagedDiscordRoles): %s\n", err)
+	}
+
+	for _, role := range mappedRoles {
+		managed[DiscordRole(role)] = true
+	}
+
+	return managed
+}
+
+// Adds a user's own extra roles, current and removed, to the managed roles. Extra roles granted to other
+// users stay unmanaged, so granting a role to one member never strips a manually granted copy from others.
+func withUserManagedRoles(managed map[DiscordRole]bool, extras []models.UserDiscordRole) map[DiscordRole]bool {
+	userManaged := make(map[DiscordRole]bool, len(managed)+len(extras))
+	for role := range managed {
+		userManaged[role] = true
+	}
+	for _, extra := range extras {
+		userManaged[DiscordRole(extra.RoleId)] = true
+	}
+	return userManaged
+}
+
+// UserManagedDiscordRoles returns the roles a sync may change for the user, the mapped roles along with
+// the user's own extra roles, including removed ones so they are taken away
+func UserManagedDiscordRoles(user *models.User) map[DiscordRole]bool {
+	var extras []models.UserDiscordRole
+	if err := initializers.DB.Unscoped().Where("discord_id = ?", user.DiscordId).Find(&extras).Error; err != nil {
+		fmt.Printf("Failed to fetch extra roles (roles.UserManagedDiscordRoles): %s\n", err)
+	}
+	return withUserManagedRoles(ManagedDiscordRoles(), extras)
+}
+
+// MergeManagedRoles keeps the member's roles that the backend does not manage and replaces
+// the managed ones with the desired roles. It also returns the roles added and removed.
+func MergeManagedRoles(current []DiscordRole, desired []DiscordRole, managed map[DiscordRole]bool) (merged []DiscordRole, added []DiscordRole, removed []DiscordRole) {
+	desiredSet := make(map[DiscordRole]bool)
+	for _, role := range desired {
+		desiredSet[role] = true
+	}
+
+	currentSet := make(map[DiscordRole]bool)
+	for _, role := range current {
+		currentSet[role] = true
+
+		if managed[role] && !desiredSet[role] {
+			removed = append(removed, role)
+			continue
+		}
+		merged = append(merged, role)
+	}
+
+	for _, role := range desired {
+		if !currentSet[role] {
+			merged = append(merged, role)
+			added = append(added, role)
+			currentSet[role] = true
+		}
+	}
+
+	if merged == nil {
+		merged = []DiscordRole{}
+	}
+	return merged, added, removed
+}
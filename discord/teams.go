@@ -0,0 +1,279 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/utmmcss/deerhacks-backend/initializers"
+	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm/clause"
+)
+
+// Discord channel types
+const (
+	channelTypeText  = 0
+	channelTypeVoice = 2
+)
+
+// Discord permission overwrite types
+const (
+	overwriteRole   = 0
+	overwriteMember = 1
+)
+
+// Discord permission bits
+const (
+	permViewChannel        = 1 << 10
+	permSendMessages       = 1 << 11
+	permAttachFiles        = 1 << 15
+	permReadMessageHistory = 1 << 16
+	permConnect            = 1 << 20
+	permSpeak              = 1 << 21
+	permManageChannels     = 1 << 4
+)
+
+// Permissions team members and mentors get in their team's channels
+const teamChannelPermissions = permViewChannel | permSendMessages | permAttachFiles | permReadMessageHistory | permConnect | permSpeak
+
+type permissionOverwrite struct {
+	ID    string `json:"id"`
+	Type  int    `json:"type"`
+	Allow string `json:"allow"`
+	Deny  string `json:"deny"`
+}
+
+type guildChannel struct {
+	Name                 string                `json:"name"`
+	Type                 int                   `json:"type,omitempty"`
+	ParentID             string                `json:"parent_id,omitempty"`
+	PermissionOverwrites []permissionOverwrite `json:"permission_overwrites"`
+}
+
+var channelNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Text channel names must be lowercase without spaces, e.g. "Deer Devs!" becomes "team-deer-devs"
+func teamTextChannelName(team *models.Team) string {
+	slug := strings.Trim(channelNamePattern.ReplaceAllString(strings.ToLower(team.Name), "-"), "-")
+	if slug == "" {
+		slug = strconv.FormatUint(uint64(team.ID), 10)
+	}
+	return truncateRunes("team-"+slug, 100)
+}
+
+// Builds the overwrites that hide the channel from everyone except the team, mentors and the bot.
+// Archived teams keep read access to their text channel but can no longer send messages.
+func teamOverwrites(team *models.Team, memberIds []string) []permissionOverwrite {
+	allow := strconv.Itoa(teamChannelPermissions)
+	deny := "0"
+	if team.Archived {
+		allow = strconv.Itoa(permViewChannel | permReadMessageHistory)
+		deny = strconv.Itoa(permSendMessages | permAttachFiles | permConnect | permSpeak)
+	}
+
+	overwrites := []permissionOverwrite{
+		// The @everyone role shares the guild's id
+		{ID: os.Getenv("GUILD_ID"), Type: overwriteRole, Allow: "0", Deny: strconv.Itoa(permViewChannel)},
+		// The bot's user id is its application id
+		{ID: os.Getenv("CLIENT_ID"), Type: overwriteMember, Allow: strconv.Itoa(permViewChannel | permManageChannels), Deny: "0"},
+	}
+
+	if mentorRole := os.Getenv("DISCORD_MENTOR_ROLE_ID"); mentorRole != "" {
+		overwrites = append(overwrites, permissionOverwrite{ID: mentorRole, Type: overwriteRole, Allow: allow, Deny: deny})
+	}
+
+	for _, memberId := range memberIds {
+		overwrites = append(overwrites, permissionOverwrite{ID: memberId, Type: overwriteMember, Allow: allow, Deny: deny})
+	}
+
+	return overwrites
+}
+
+// Creates a channel and returns its id
+func createTeamChannel(channel guildChannel) (string, error) {
+	resp, err := API().Request("POST", "/guilds/"+os.Getenv("GUILD_ID")+"/channels", channel)
+	if err != nil {
+		return "", fmt.Errorf("failed to create channel: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return "", parseRateLimit(resp)
+	} else if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return "", fmt.Errorf("failed to create channel: %w", unexpectedResponse(resp))
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to decode channel: %w", err)
+	}
+	return created.ID, nil
+}
+
+// Updates an existing channel, returning false if it no longer exists
+func updateTeamChannel(channelId string, channel guildChannel) (bool, error) {
+	// A channel's type cannot be changed
+	channel.Type = 0
+
+	resp, err := API().Request("PATCH", "/channels/"+channelId, channel)
+	if err != nil {
+		return false, fmt.Errorf("failed to update channel: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return false, nil
+	} else if resp.StatusCode == 429 {
+		return false, parseRateLimit(resp)
+	} else if resp.StatusCode != 200 {
+		return false, fmt.Errorf("failed to update channel: %w", unexpectedResponse(resp))
+	}
+	return true, nil
+}
+
+func deleteTeamChannel(channelId string) error {
+	resp, err := API().Request("DELETE", "/channels/"+channelId, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete channel: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return parseRateLimit(resp)
+	} else if resp.StatusCode != 200 && resp.StatusCode != 404 {
+		return fmt.Errorf("failed to delete channel: %w", unexpectedResponse(resp))
+	}
+	return nil
+}
+
+// Creates the channel if channelId is empty or the channel was deleted, otherwise updates it.
+// A created channel's id is saved straight away so a retry does not create it again.
+func upsertTeamChannel(team *models.Team, column string, channelId string, channel guildChannel) error {
+	if channelId != "" {
+		exists, err := updateTeamChannel(channelId, channel)
+		if err != nil || exists {
+			return err
+		}
+	}
+
+	channelId, err := createTeamChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	if err := initializers.DB.Model(team).Update(column, channelId).Error; err != nil {
+		return fmt.Errorf("failed to save channel id: %w", err)
+	}
+	return nil
+}
+
+// SyncTeamChannels creates or updates the team's private text and voice channels so only its
+// current members and mentors can see them. Archived teams have their voice channel deleted and
+// their text channel made read only, moved to DISCORD_TEAM_ARCHIVE_CATEGORY_ID if it is set.
+func SyncTeamChannels(team *models.Team) error {
+	var memberIds []string
+	if err := initializers.DB.Model(&models.TeamMember{}).Where("team_id = ?", team.ID).Pluck("discord_id", &memberIds).Error; err != nil {
+		return fmt.Errorf("(teams.SyncTeamChannels) failed to fetch team members: %w", err)
+	}
+
+	overwrites := teamOverwrites(team, memberIds)
+
+	if team.Archived {
+		if team.VoiceChannelId != "" {
+			if err := deleteTeamChannel(team.VoiceChannelId); err != nil {
+				return fmt.Errorf("(teams.SyncTeamChannels) %w", err)
+			}
+			if err := initializers.DB.Model(team).Update("voice_channel_id", "").Error; err != nil {
+				return fmt.Errorf("(teams.SyncTeamChannels) failed to clear voice channel id: %w", err)
+			}
+		}
+
+		if team.TextChannelId != "" {
+			channel := guildChannel{
+				Name:                 teamTextChannelName(team),
+				ParentID:             os.Getenv("DISCORD_TEAM_ARCHIVE_CATEGORY_ID"),
+				PermissionOverwrites: overwrites,
+			}
+			if _, err := updateTeamChannel(team.TextChannelId, channel); err != nil {
+				return fmt.Errorf("(teams.SyncTeamChannels) %w", err)
+			}
+		}
+
+		fmt.Printf("(teams.SyncTeamChannels) Archived channels for team %d\n", team.ID)
+		return nil
+	}
+
+	textData := guildChannel{
+		Name:                 teamTextChannelName(team),
+		Type:                 channelTypeText,
+		ParentID:             os.Getenv("DISCORD_TEAM_CATEGORY_ID"),
+		PermissionOverwrites: overwrites,
+	}
+	if err := upsertTeamChannel(team, "text_channel_id", team.TextChannelId, textData); err != nil {
+		return fmt.Errorf("(teams.SyncTeamChannels) %w", err)
+	}
+
+	voiceData := guildChannel{
+		Name:                 truncateRunes(team.Name, 100),
+		Type:                 channelTypeVoice,
+		ParentID:             os.Getenv("DISCORD_TEAM_CATEGORY_ID"),
+		PermissionOverwrites: overwrites,
+	}
+	if err := upsertTeamChannel(team, "voice_channel_id", team.VoiceChannelId, voiceData); err != nil {
+		return fmt.Errorf("(teams.SyncTeamChannels) %w", err)
+	}
+
+	fmt.Printf("(teams.SyncTeamChannels) Synced channels for team %d with %d members\n", team.ID, len(memberIds))
+	return nil
+}
+
+// EnqueueTeam adds the team to the channel queue, or makes its existing item due immediately with fresh attempts
+func EnqueueTeam(teamId uint) error {
+	onConflict := clause.OnConflict{
+		Columns: []clause.Column{{Name: "team_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"last_error":      "",
+		}),
+	}
+
+	item := models.TeamChannelQueue{TeamId: teamId, NextAttemptAt: time.Now()}
+	if err := initializers.DB.Clauses(onConflict).Create(&item).Error; err != nil {
+		return err
+	}
+
+	notifyQueue("team")
+	return nil
+}
+
+var teamQueue = &leaseQueue{
+	Event:   "team",
+	Table:   models.TeamChannelQueue{}.TableName(),
+	Key:     "team_id",
+	Subject: "team",
+	Process: func(item queueItem) error {
+		teamId, err := strconv.ParseUint(item.Key, 10, 64)
+		if err != nil {
+			return err
+		}
+		var team models.Team
+		if err := initializers.DB.Limit(1).Find(&team, teamId).Error; err != nil {
+			return err
+		}
+		if team.ID == 0 {
+			return nil
+		}
+		return SyncTeamChannels(&team)
+	},
+	DeadLetter: func(item queueItem) models.DiscordDeadLetter {
+		return models.DiscordDeadLetter{Event: "team", Payload: item.Key}
+	},
+	NotifyStaff: true,
+}
@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Most characters of resume text kept for search
+const maxResumeTextLength = 20000
+
+// Rebuilds the text of a page from its glyphs, which are positioned individually. Spaces are often
+// not drawn, so a space is added wherever there is a gap between glyphs or the line changes.
+func pageText(page pdf.Page) (text string, err error) {
+	// The parser panics on some malformed pages
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	var builder strings.Builder
+	var previous *pdf.Text
+	for _, glyph := range page.Content().Text {
+		glyph := glyph
+		if previous != nil {
+			gap := glyph.X - (previous.X + previous.W)
+			if math.Abs(glyph.Y-previous.Y) > previous.FontSize/2 || gap > glyph.FontSize*0.15 || gap < -glyph.FontSize {
+				builder.WriteString(" ")
+			}
+		}
+		builder.WriteString(glyph.S)
+		previous = &glyph
+	}
+	return builder.String(), nil
+}
+
+// Reads the text of every page, skipping pages the parser cannot handle
+func readPDFText(data []byte) (text string, err error) {
+	// The parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text, err := pageText(page)
+		if err != nil {
+			continue
+		}
+		builder.WriteString(text)
+		builder.WriteString("\n")
+	}
+
+	return builder.String(), nil
+}
+
+// ExtractResumeText returns the plain text of a resume PDF for full text search, with control
+// characters and repeated whitespace collapsed. Resumes without a text layer give an empty string.
+func ExtractResumeText(data []byte) (string, error) {
+	text, err := readPDFText(data)
+	if err != nil {
+		return "", err
+	}
+
+	// Postgres rejects null bytes and invalid UTF-8 in text columns
+	text = strings.ToValidUTF8(text, " ")
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, text)
+	text = strings.Join(strings.Fields(text), " ")
+
+	if len(text) > maxResumeTextLength {
+		text = strings.ToValidUTF8(text[:maxResumeTextLength], "")
+	}
+	return text, nil
+}
@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+func GenerateQRCodePNG(content string, size int) ([]byte, error) {
+	png, err := qrcode.Encode(content, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("GenerateQRCodePNG - %w", err)
+	}
+	return png, nil
+}
+
+func GenerateQRCodeSVG(content string, size int) (string, error) {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return "", fmt.Errorf("GenerateQRCodeSVG - %w", err)
+	}
+
+	// Bitmap includes the quiet zone, so each module maps to one unit of the viewBox
+	bitmap := qr.Bitmap()
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#ffffff"/>`+
+		`<path fill="#000000" d="%s"/>`+
+		`</svg>`,
+		size, size, modules, modules, path.String())
+
+	return svg, nil
+}
@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/utmmcss/deerhacks-backend/models"
+	"gorm.io/gorm"
+)
+
+// ResumeQuotaPolicy limits how often a user can upload a resume: WindowUploads in any rolling Window,
+// and Lifetime uploads in total. Admins can grant a user uploads beyond the lifetime cap.
+type ResumeQuotaPolicy struct {
+	WindowUploads int
+	Window        time.Duration
+	Lifetime      int
+}
+
+// ResumeQuota is what is left of a user's quota. ResetAt is when the next upload leaves the window and
+// frees up another one. RetryAfter is set when the window is used up but the lifetime cap is not, so the
+// user can upload again once an upload leaves the window.
+type ResumeQuota struct {
+	Remaining  int
+	ResetAt    time.Time
+	RetryAfter time.Duration
+}
+
+func positiveEnv(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// GetResumeQuotaPolicy reads the quota policy from RESUME_QUOTA_WINDOW_UPLOADS (default 3),
+// RESUME_QUOTA_WINDOW_HOURS (default 24) and RESUME_QUOTA_LIFETIME (default 3)
+func GetResumeQuotaPolicy() ResumeQuotaPolicy {
+	return ResumeQuotaPolicy{
+		WindowUploads: positiveEnv("RESUME_QUOTA_WINDOW_UPLOADS", 3),
+		Window:        time.Duration(positiveEnv("RESUME_QUOTA_WINDOW_HOURS", 24)) * time.Hour,
+		Lifetime:      positiveEnv("RESUME_QUOTA_LIFETIME", 3),
+	}
+}
+
+// RecentUploads returns when the user's uploads within the window before now were made, oldest first.
+// Every upload is kept as a resume version, and versions this recent are never pruned.
+func (policy ResumeQuotaPolicy) RecentUploads(db *gorm.DB, discordId string, now time.Time) ([]time.Time, error) {
+	var uploads []time.Time
+	err := db.Model(&models.ResumeVersion{}).
+		Where("discord_id = ? AND created_at > ?", discordId, now.Add(-policy.Window)).
+		Order("created_at ASC").
+		Pluck("created_at", &uploads).Error
+	return uploads, err
+}
+
+// QuotaFor returns what is left of the user's quota at now, given their RecentUploads
+func (policy ResumeQuotaPolicy) QuotaFor(user models.User, recentUploads []time.Time, now time.Time) ResumeQuota {
+	lifetimeRemaining := policy.Lifetime + user.ResumeGrantCount - user.ResumeUpdateCount
+	if lifetimeRemaining < 0 {
+		lifetimeRemaining = 0
+	}
+
+	windowRemaining := policy.WindowUploads - len(recentUploads)
+	if windowRemaining < 0 {
+		windowRemaining = 0
+	}
+
+	quota := ResumeQuota{Remaining: lifetimeRemaining}
+	if windowRemaining < quota.Remaining {
+		quota.Remaining = windowRemaining
+	}
+
+	if len(recentUploads) > 0 {
+		// With the window used up, enough uploads have to leave it to get back under the limit
+		next := 0
+		if windowRemaining == 0 {
+			next = len(recentUploads) - policy.WindowUploads
+		}
+		quota.ResetAt = recentUploads[next].Add(policy.Window)
+		if windowRemaining == 0 && lifetimeRemaining > 0 {
+			quota.RetryAfter = quota.ResetAt.Sub(now)
+		}
+	}
+	return quota
+}
+
+// ExceededMessage explains to the user why they cannot upload, when Remaining is zero
+func (quota ResumeQuota) ExceededMessage() string {
+	if quota.RetryAfter > 0 {
+		return "Too many resume uploads, try again later"
+	}
+	return "Resume upload limit reached, contact an organizer for more uploads"
+}
+
+// Headers describes the quota to clients. Retry-After is only sent while the user has to wait for the
+// window to reset.
+func (quota ResumeQuota) Headers() map[string]string {
+	headers := map[string]string{
+		"X-Resume-Quota-Remaining": strconv.Itoa(quota.Remaining),
+	}
+	if !quota.ResetAt.IsZero() {
+		headers["X-Resume-Quota-Reset"] = quota.ResetAt.UTC().Format(time.RFC3339)
+	}
+	if quota.RetryAfter > 0 {
+		headers["Retry-After"] = strconv.Itoa(int(math.Ceil(quota.RetryAfter.Seconds())))
+	}
+	return headers
+}
@@ -0,0 +1,141 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resume scan statuses stored on the application
+const (
+	ResumeScanClean       = "clean"
+	ResumeScanInfected    = "infected"
+	ResumeScanSkipped     = "skipped"     // No scanner is configured
+	ResumeScanUnavailable = "unavailable" // The scanner could not be reached and the policy is to fail open
+)
+
+// Resume scan error codes
+const (
+	ResumeMalware          = "malware_detected"
+	ResumeScanNotAvailable = "scan_unavailable"
+)
+
+// ErrScannerUnavailable is returned when the scanner cannot be reached or does not give a result
+var ErrScannerUnavailable = errors.New("resume scanner unavailable")
+
+// clamd reads INSTREAM data in chunks, each prefixed with its length
+const clamdChunkSize = 64 * 1024
+
+// ResumeScanResult is the outcome of scanning a resume, with the signature that matched if it was infected
+type ResumeScanResult struct {
+	Status    string
+	Signature string
+	ScannedAt time.Time
+}
+
+// Parses RESUME_SCANNER_ADDR, either host:port, tcp://host:port or unix:///path/to/clamd.sock
+func scannerAddress() (network string, address string) {
+	address = os.Getenv("RESUME_SCANNER_ADDR")
+	if strings.HasPrefix(address, "unix://") {
+		return "unix", strings.TrimPrefix(address, "unix://")
+	}
+	return "tcp", strings.TrimPrefix(address, "tcp://")
+}
+
+func scannerTimeout() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("RESUME_SCANNER_TIMEOUT")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// ScannerFailsOpen reports whether resumes are accepted without a scan when the scanner is unavailable.
+// Set RESUME_SCANNER_POLICY to "open" to allow them, by default they are rejected.
+func ScannerFailsOpen() bool {
+	return os.Getenv("RESUME_SCANNER_POLICY") == "open"
+}
+
+// Streams data to clamd with the INSTREAM command and returns its reply
+func clamdInstream(data []byte) (string, error) {
+	network, address := scannerAddress()
+	conn, err := net.DialTimeout(network, address, scannerTimeout())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(scannerTimeout())); err != nil {
+		return "", err
+	}
+
+	// The z prefix makes clamd expect and reply with null terminated commands
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+
+	size := make([]byte, 4)
+	for start := 0; start < len(data); start += clamdChunkSize {
+		end := start + clamdChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		binary.BigEndian.PutUint32(size, uint32(end-start))
+		if _, err := conn.Write(size); err != nil {
+			return "", err
+		}
+		if _, err := conn.Write(data[start:end]); err != nil {
+			return "", err
+		}
+	}
+
+	// A zero length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return "", err
+	}
+
+	reply, err := io.ReadAll(io.LimitReader(conn, 4096))
+	if err != nil && len(reply) == 0 {
+		return "", err
+	}
+
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// ScanResume sends a resume to the clamd compatible scanner at RESUME_SCANNER_ADDR. With no scanner
+// configured the result is skipped. ErrScannerUnavailable is returned if the scanner cannot be used.
+func ScanResume(data []byte) (ResumeScanResult, error) {
+	result := ResumeScanResult{ScannedAt: time.Now()}
+
+	if os.Getenv("RESUME_SCANNER_ADDR") == "" {
+		result.Status = ResumeScanSkipped
+		return result, nil
+	}
+
+	reply, err := clamdInstream(data)
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", ErrScannerUnavailable, err)
+	}
+
+	// Replies look like "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		result.Status = ResumeScanClean
+	case strings.HasSuffix(reply, " FOUND"):
+		result.Status = ResumeScanInfected
+		result.Signature = strings.TrimSuffix(reply, " FOUND")
+	default:
+		return result, fmt.Errorf("%w: %s", ErrScannerUnavailable, reply)
+	}
+
+	return result, nil
+}
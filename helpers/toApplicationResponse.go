@@ -28,6 +28,7 @@ type InnerApplication struct {
 	Education             string           `json:"education" validate:"required,lte=128"`
 	School                string           `json:"school"  validate:"required,lte=128"`
 	Program               string           `json:"program"  validate:"required,lte=128"`
+	GraduationYear        int              `json:"graduation_year" validate:"omitempty,gte=1950,lte=2100"`
 	Portfolio             string           `json:"portfolio" validate:"lte=128"`
 	Github                string           `json:"github" validate:"lte=128"`
 	Linkedin              string           `json:"linkedin" validate:"lte=128"`
@@ -36,6 +37,7 @@ type InnerApplication struct {
 	DeerhacksExperience   []string         `json:"deerhacks_experience" validate:"required,gt=0,lt=20,dive,lte=128"`
 	TeamPreference        string           `json:"team_preference" validate:"required,lte=128"`
 	Interests             []string         `json:"interests" validate:"required,gt=0,lt=20,dive,lte=128"`
+	Skills                []string         `json:"skills" validate:"lt=20,dive,lte=128"`
 	DeerhacksPitch        string           `json:"deerhacks_pitch" validate:"required,lte=1500"`
 	SharedProject         string           `json:"shared_project" validate:"required,lte=1500"`
 	FutureTech            string           `json:"future_tech" validate:"required,lte=1500"`
@@ -56,11 +58,13 @@ func ToApplicationResponse(application models.Application) ApplicationResponse {
 	var dietRestriction = []string{}
 	var deerhacksExperience = []string{}
 	var interests = []string{}
+	var skills = []string{}
 
 	application.Ethnicity.AssignTo(&ethnicity)
 	application.DietRestriction.AssignTo(&dietRestriction)
 	application.DeerhacksExperience.AssignTo(&deerhacksExperience)
 	application.Interests.AssignTo(&interests)
+	application.Skills.AssignTo(&skills)
 
 	return ApplicationResponse{
 		IsDraft: application.IsDraft,
@@ -88,6 +92,7 @@ func ToApplicationResponse(application models.Application) ApplicationResponse {
 			Education:             application.Education,
 			School:                application.School,
 			Program:               application.Program,
+			GraduationYear:        application.GraduationYear,
 			Portfolio:             application.Portfolio,
 			Github:                application.Github,
 			Linkedin:              application.Linkedin,
@@ -96,6 +101,7 @@ func ToApplicationResponse(application models.Application) ApplicationResponse {
 			DeerhacksExperience:   deerhacksExperience,
 			TeamPreference:        application.TeamPreference,
 			Interests:             interests,
+			Skills:                skills,
 			DeerhacksPitch:        application.DeerhacksPitch,
 			SharedProject:         application.SharedProject,
 			FutureTech:            application.FutureTech,
@@ -18,6 +18,8 @@ func ValidateApplication(application models.Application) (bool, []string) {
 		switch field.Field() {
 		case "Age":
 			errList = append(errList, "Age is missing or under 18/over 100")
+		case "GraduationYear":
+			errList = append(errList, "GraduationYear is invalid")
 		case "ShirtSize":
 			errList = append(errList, "ShirtSize is missing or invalid")
 		case "ResumeConsent":
@@ -0,0 +1,274 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ResumeValidationError explains why a resume was rejected, with a Code the frontend can show a specific message for
+type ResumeValidationError struct {
+	Code    string
+	Message string
+}
+
+func (e *ResumeValidationError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Resume validation error codes
+const (
+	ResumeNotPDF        = "not_pdf"
+	ResumeMalformed     = "malformed_pdf"
+	ResumeEncrypted     = "encrypted_pdf"
+	ResumeTooManyPages  = "too_many_pages"
+	ResumeJavaScript    = "javascript"
+	ResumeOpenAction    = "open_action"
+	ResumeLaunchAction  = "launch_action"
+	ResumeEmbeddedFile  = "embedded_file"
+	ResumeXFAForm       = "xfa_form"
+	ResumeFileTooLarge  = "file_too_large"
+	ResumeFileTypeError = "unsupported_file_type"
+)
+
+// Page limit used when RESUME_MAX_PAGES is not set
+const defaultResumeMaxPages = 3
+
+// Largest decompressed object stream that is scanned, larger ones are rejected
+const maxObjectStreamBytes = 16 * 1024 * 1024
+
+// Names that are rejected wherever they appear in the document's objects. Attachments are caught by
+// their file specification's /EF entry, since some generators write an empty /EmbeddedFiles tree.
+var forbiddenPDFNames = map[string]*ResumeValidationError{
+	"JS":           {ResumeJavaScript, "Resume contains JavaScript"},
+	"JavaScript":   {ResumeJavaScript, "Resume contains JavaScript"},
+	"Launch":       {ResumeLaunchAction, "Resume contains a launch action"},
+	"EF":           {ResumeEmbeddedFile, "Resume contains an embedded file"},
+	"EmbeddedFile": {ResumeEmbeddedFile, "Resume contains an embedded file"},
+	"XFA":          {ResumeXFAForm, "Resume contains an XFA form"},
+	"Encrypt":      {ResumeEncrypted, "Resume is encrypted"},
+}
+
+func resumeMaxPages() int {
+	if maxPages, err := strconv.Atoi(os.Getenv("RESUME_MAX_PAGES")); err == nil && maxPages > 0 {
+		return maxPages
+	}
+	return defaultResumeMaxPages
+}
+
+func isPDFWhitespace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+func isPDFDelimiter(b byte) bool {
+	return isPDFWhitespace(b) || bytes.IndexByte([]byte("()<>[]{}/%"), b) >= 0
+}
+
+// Reads the name starting after the '/' at data[i], decoding #xx escapes that could hide a name
+// such as /J#53. Returns the name and the index after it.
+func readPDFName(data []byte, i int) (string, int) {
+	var name []byte
+	for i < len(data) && !isPDFDelimiter(data[i]) {
+		if data[i] == '#' && i+2 < len(data) {
+			if b, err := strconv.ParseUint(string(data[i+1:i+3]), 16, 8); err == nil {
+				name = append(name, byte(b))
+				i += 3
+				continue
+			}
+		}
+		name = append(name, data[i])
+		i++
+	}
+	return string(name), i
+}
+
+// Skips a literal string starting after the '(' at data[i], returning the index after it
+func skipPDFString(data []byte, i int) int {
+	depth := 1
+	for i < len(data) && depth > 0 {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		i++
+	}
+	return i
+}
+
+// Walks the object syntax of data, skipping strings, comments and stream data so only real names
+// are checked. Object streams hide objects inside compressed streams, so they are decompressed and
+// scanned too.
+func scanPDFObjects(data []byte, nested bool) *ResumeValidationError {
+	var objectNames []string
+
+	for i := 0; i < len(data); {
+		switch b := data[i]; {
+		case b == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case b == '(':
+			i = skipPDFString(data, i+1)
+		case b == '<' && i+1 < len(data) && data[i+1] == '<':
+			i += 2
+		case b == '<':
+			end := bytes.IndexByte(data[i:], '>')
+			if end < 0 {
+				return &ResumeValidationError{ResumeMalformed, "Resume has an unterminated string"}
+			}
+			i += end + 1
+		case b == '/':
+			var name string
+			name, i = readPDFName(data, i+1)
+			objectNames = append(objectNames, name)
+
+			if err, ok := forbiddenPDFNames[name]; ok {
+				return err
+			}
+
+			// Destinations that open the resume at a page are fine, but actions run on open are not
+			if name == "OpenAction" {
+				j := i
+				for j < len(data) && isPDFWhitespace(data[j]) {
+					j++
+				}
+				if j >= len(data) || data[j] != '[' {
+					return &ResumeValidationError{ResumeOpenAction, "Resume runs an action when opened"}
+				}
+			}
+		case b >= 'a' && b <= 'z':
+			start := i
+			for i < len(data) && !isPDFDelimiter(data[i]) {
+				i++
+			}
+			keyword := string(data[start:i])
+
+			if keyword == "obj" {
+				objectNames = nil
+			} else if keyword == "stream" && !nested {
+				// Stream data starts after the end of line following the keyword
+				if i < len(data) && data[i] == '\r' {
+					i++
+				}
+				if i < len(data) && data[i] == '\n' {
+					i++
+				}
+				end := bytes.Index(data[i:], []byte("endstream"))
+				if end < 0 {
+					return &ResumeValidationError{ResumeMalformed, "Resume has an unterminated stream"}
+				}
+
+				if containsName(objectNames, "ObjStm") {
+					if err := scanObjectStream(data[i:i+end], objectNames); err != nil {
+						return err
+					}
+				}
+				i += end + len("endstream")
+			}
+		default:
+			i++
+		}
+	}
+
+	return nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Decompresses and scans an object stream. Object streams that cannot be read are rejected,
+// since they could hide anything.
+func scanObjectStream(data []byte, names []string) *ResumeValidationError {
+	filters := 0
+	for _, name := range names {
+		if name == "FlateDecode" {
+			filters++
+		} else if len(name) > 6 && name[len(name)-6:] == "Decode" {
+			return &ResumeValidationError{ResumeMalformed, "Resume has an unsupported object stream"}
+		}
+	}
+	if filters > 1 || containsName(names, "DecodeParms") {
+		return &ResumeValidationError{ResumeMalformed, "Resume has an unsupported object stream"}
+	}
+
+	if filters == 1 {
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return &ResumeValidationError{ResumeMalformed, "Resume has a corrupt object stream"}
+		}
+		data, err = io.ReadAll(io.LimitReader(reader, maxObjectStreamBytes+1))
+		if err != nil && len(data) == 0 {
+			return &ResumeValidationError{ResumeMalformed, "Resume has a corrupt object stream"}
+		}
+		if len(data) > maxObjectStreamBytes {
+			return &ResumeValidationError{ResumeMalformed, "Resume has an oversized object stream"}
+		}
+	}
+
+	return scanPDFObjects(data, true)
+}
+
+// Parses the cross reference table and page tree, returning the number of pages
+func countPDFPages(data []byte) (pages int, err error) {
+	// The parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	if reader.Trailer().Key("Root").IsNull() {
+		return 0, fmt.Errorf("missing document catalog")
+	}
+	return reader.NumPage(), nil
+}
+
+// ValidateResumePDF checks an uploaded resume is a well formed PDF within the page limit, without
+// JavaScript, actions run on open, launch actions, embedded files or XFA forms. It returns the
+// first problem found.
+func ValidateResumePDF(data []byte) *ResumeValidationError {
+	// The header must appear within the first 1024 bytes
+	header := data
+	if len(header) > 1024 {
+		header = header[:1024]
+	}
+	if !bytes.Contains(header, []byte("%PDF-")) {
+		return &ResumeValidationError{ResumeNotPDF, "Resume is not a PDF"}
+	}
+
+	if err := scanPDFObjects(data, false); err != nil {
+		return err
+	}
+
+	pages, err := countPDFPages(data)
+	if err != nil {
+		return &ResumeValidationError{ResumeMalformed, "Resume could not be read as a PDF"}
+	}
+	if pages < 1 {
+		return &ResumeValidationError{ResumeMalformed, "Resume has no pages"}
+	}
+	if maxPages := resumeMaxPages(); pages > maxPages {
+		return &ResumeValidationError{ResumeTooManyPages, fmt.Sprintf("Resume must be at most %d pages", maxPages)}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+// Builds a PDF with a correct cross reference table from the bodies of objects 1, 2, ... Object 1 is the catalog.
+func buildTestPDF(objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := []int{}
+	for i, object := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// Wraps data in a stream object with the given extra dictionary entries
+func testStream(entries string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", entries, len(data), data)
+}
+
+func flate(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A one page resume, with catalog entries and page content supplied by the test
+func testResume(catalog string, content string, extra ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R " + catalog + " >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		testStream("", []byte(content)),
+	}
+	return buildTestPDF(append(objects, extra...)...)
+}
+
+func expectCode(t *testing.T, err *ResumeValidationError, code string) {
+	t.Helper()
+	if code == "" {
+		if err != nil {
+			t.Errorf("got %v, want no error", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Errorf("got no error, want %s", code)
+	} else if err.Code != code {
+		t.Errorf("got %v, want %s", err, code)
+	}
+}
+
+func TestValidateResumePDFAcceptsJSInStrings(t *testing.T) {
+	resume := testResume(
+		"/PageLabels << /Nums [0 << /P (Uses /JS and /JavaScript daily) >>] >>",
+		"BT /F1 12 Tf 72 720 Td (Skills: /JS, /JavaScript, /Launch \\) /EF) Tj ET",
+	)
+	expectCode(t, ValidateResumePDF(resume), "")
+}
+
+func TestValidateResumePDFNameEscapes(t *testing.T) {
+	for _, name := range []string{"/J#53", "/#4A#53", "/Java#53cript", "/#4Caunch"} {
+		t.Run(name, func(t *testing.T) {
+			resume := testResume("/AA << /WC << /S "+name+" >> >>", "BT ET")
+			code := ResumeJavaScript
+			if name == "/#4Caunch" {
+				code = ResumeLaunchAction
+			}
+			expectCode(t, ValidateResumePDF(resume), code)
+		})
+	}
+}
+
+func TestValidateResumePDFOpenAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		openAction string
+		code       string
+	}{
+		{"destination array", "/OpenAction [3 0 R /Fit]", ""},
+		{"destination array without space", "/OpenAction[3 0 R /XYZ 0 792 0]", ""},
+		{"action dictionary", "/OpenAction << /S /GoTo /D [3 0 R /Fit] >>", ResumeOpenAction},
+		{"indirect action", "/OpenAction 5 0 R", ResumeOpenAction},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resume := testResume(test.openAction, "BT ET", "<< /S /GoTo /D [3 0 R /Fit] >>")
+			expectCode(t, ValidateResumePDF(resume), test.code)
+		})
+	}
+}
+
+func TestValidateResumePDFObjectStreams(t *testing.T) {
+	// Object 6 stored inside the object stream, after the "<object number> <offset>" header
+	hidden := "6 0 << /S /JavaScript /JS (app.alert(1)) >>"
+	clean := "6 0 << /Title (Uses /JS daily) >>"
+
+	tests := []struct {
+		name   string
+		stream string
+		code   string
+	}{
+		{"javascript in flate stream", testStream("/Type /ObjStm /N 1 /First 4 /Filter /FlateDecode", flate(t, hidden)), ResumeJavaScript},
+		{"javascript in filter array", testStream("/Type /ObjStm /N 1 /First 4 /Filter [/FlateDecode]", flate(t, hidden)), ResumeJavaScript},
+		{"javascript in uncompressed stream", testStream("/Type /ObjStm /N 1 /First 4", []byte(hidden)), ResumeJavaScript},
+		{"clean flate stream", testStream("/Type /ObjStm /N 1 /First 4 /Filter /FlateDecode", flate(t, clean)), ""},
+		{"corrupt flate stream", testStream("/Type /ObjStm /N 1 /First 4 /Filter /FlateDecode", []byte("not zlib data")), ResumeMalformed},
+		{"unsupported filter", testStream("/Type /ObjStm /N 1 /First 4 /Filter /LZWDecode", []byte(hidden)), ResumeMalformed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := buildTestPDF("<< /Type /Catalog >>", test.stream)
+			expectCode(t, scanPDFObjects(data, false), test.code)
+		})
+	}
+}
+
+func TestValidateResumePDFPlainStreamsAreSkipped(t *testing.T) {
+	// Content streams are not object streams, so names in their data are never treated as objects
+	resume := testResume("", "/JS /JavaScript BT ET")
+	expectCode(t, ValidateResumePDF(resume), "")
+}
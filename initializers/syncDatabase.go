@@ -8,8 +8,18 @@ func SyncDatabase() {
 	email_err := DB.AutoMigrate(&models.UserEmailContext{})
 	join_guild_err := DB.AutoMigrate(&models.JoinGuildQueue{})
 	update_role_err := DB.AutoMigrate(&models.UpdateRoleQueue{})
+	check_in_event_err := DB.AutoMigrate(&models.CheckInEvent{})
+	activity_err := DB.AutoMigrate(&models.Activity{}, &models.PointTransaction{})
+	hardware_err := DB.AutoMigrate(&models.HardwareItem{}, &models.HardwareCheckout{})
+	discord_role_err := DB.AutoMigrate(&models.DiscordRoleMapping{}, &models.UserDiscordRole{})
+	dead_letter_err := DB.AutoMigrate(&models.DiscordDeadLetter{})
+	notification_err := DB.AutoMigrate(&models.DiscordNotification{})
+	team_err := DB.AutoMigrate(&models.Team{}, &models.TeamMember{}, &models.TeamChannelQueue{})
+	resume_book_err := DB.AutoMigrate(&models.ResumeBook{})
+	sponsor_err := DB.AutoMigrate(&models.SponsorStar{}, &models.ResumeView{})
+	resume_version_err := DB.AutoMigrate(&models.ResumeVersion{})
 
-	if user_err != nil || app_err != nil || email_err != nil || join_guild_err != nil || update_role_err != nil {
+	if user_err != nil || app_err != nil || email_err != nil || join_guild_err != nil || update_role_err != nil || check_in_event_err != nil || activity_err != nil || hardware_err != nil || discord_role_err != nil || dead_letter_err != nil || notification_err != nil || team_err != nil || resume_book_err != nil || sponsor_err != nil || resume_version_err != nil {
 		panic("Failed to Synchronize Database")
 	}
 }
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/bot"
 	"github.com/utmmcss/deerhacks-backend/controllers"
 	"github.com/utmmcss/deerhacks-backend/discord"
 	"github.com/utmmcss/deerhacks-backend/initializers"
@@ -41,26 +43,102 @@ func main() {
 	// Start email cleanup task
 	go controllers.CleanupTableTask(12 * time.Hour)
 
+	// Resume book exports run in the background and do not survive restarts
+	controllers.FailInterruptedResumeBooks()
+	go controllers.FailInterruptedResumeBooksTask(5 * time.Minute)
+
+	// Start resume text extraction task for resumes uploaded before resume search
+	go controllers.ResumeTextBackfillTask(6 * time.Hour)
+
+	// Start pruning of resume versions past the retention policy
+	go controllers.ResumeVersionPruneTask(24 * time.Hour)
+
+	// Load discord status to role mapping
+	if err := discord.LoadRoleMapping(); err != nil {
+		fmt.Println("Failed to load discord role mapping:", err)
+	}
+
 	// Start discord Join Queue & Update Role Queue tasks
 	go discord.JoinGuildTask(15 * time.Minute)
 	go discord.UpdateRoleTask(10 * time.Minute)
+	go discord.NotificationTask(5 * time.Minute)
+	go discord.TeamChannelTask(10 * time.Minute)
+
+	// Wake the discord queue tasks as soon as users are enqueued
+	go discord.ListenQueue(os.Getenv("DB_URL"))
+
+	// Pass check ins scanned through any replica to this replica's live dashboards
+	go controllers.ListenCheckIns(os.Getenv("DB_URL"))
+
+	// Start discord token refresh task for users waiting to join
+	go discord.RefreshTokensTask(1 * time.Hour)
+
+	// Start discord guild role reconciliation task
+	go discord.ReconcileGuildTask(6 * time.Hour)
+
+	// Start discord bot gateway (opt in with DISCORD_BOT_ENABLED)
+	if _, err := bot.StartFromEnv(); err != nil {
+		fmt.Println("Failed to start discord bot:", err)
+	}
 
 	r.POST("/user-login", controllers.Login)
 	r.GET("/user-get", middleware.RequireAuth, controllers.GetUser)
+	r.GET("/user-qr", middleware.RequireAuth, controllers.GetUserQR)
 	r.POST("/user-update", middleware.RequireAuth, controllers.UpdateUser)
+	r.POST("/user-nickname-opt-out", middleware.RequireAuth, controllers.UpdateNicknameOptOut)
 	r.POST("/user-logout", middleware.RequireAuth, controllers.LogoutUser)
 	r.GET("/admin-user-get", middleware.RequireAuth, controllers.AdminUserGet)
 	r.POST("/email-verify", controllers.VerifyEmail)
 
 	r.POST("/qr-check-in", middleware.RequireAuth, controllers.AdminQRCheckIn)
+	r.GET("/admin-check-in-stats", middleware.RequireAuth, controllers.AdminCheckInStats)
+	r.GET("/admin-check-in-stream", middleware.RequireAuth, controllers.AdminCheckInStream)
+
+	r.GET("/admin-activity-list", middleware.RequireAuth, controllers.AdminActivityList)
+	r.POST("/admin-activity-update", middleware.RequireAuth, controllers.AdminActivityUpdate)
+	r.GET("/admin-leaderboard", middleware.RequireAuth, controllers.AdminLeaderboard)
+	r.POST("/admin-raffle-draw", middleware.RequireAuth, controllers.AdminRaffleDraw)
+
+	r.GET("/hardware-list", middleware.RequireAuth, controllers.HardwareList)
+	r.POST("/admin-hardware-update", middleware.RequireAuth, controllers.AdminHardwareUpdate)
+	r.POST("/hardware-checkout", middleware.RequireAuth, controllers.HardwareCheckout)
+	r.POST("/hardware-return", middleware.RequireAuth, controllers.HardwareReturn)
+	r.GET("/hardware-outstanding", middleware.RequireAuth, controllers.HardwareOutstanding)
 	r.POST("/admin-user-update", middleware.RequireAuth, controllers.UpdateAdmin)
 
 	r.GET("/application-get", middleware.RequireAuth, controllers.GetApplicaton)
 	r.POST("/application-update", middleware.RequireAuth, controllers.UpdateApplication)
 
 	r.GET("/resume-get", middleware.RequireAuth, controllers.GetResume)
+	r.GET("/resume/:discord_id", middleware.RequireAuth, controllers.ResumeRedirect)
 	r.POST("/resume-update", middleware.RequireAuth, middleware.ResumeUpdateRateLimit, controllers.UpdateResume)
+	r.POST("/resume-upload-url", middleware.RequireAuth, middleware.ResumeUpdateRateLimit, controllers.ResumeUploadURL)
+	r.POST("/resume-upload-confirm", middleware.RequireAuth, middleware.ResumeUpdateRateLimit, controllers.ConfirmResumeUpload)
+	r.GET("/resume-file", controllers.ServeResumeFile)
+	r.PUT("/resume-file", controllers.UploadResumeFile)
+	r.POST("/admin-resume-book", middleware.RequireAuth, controllers.AdminResumeBookCreate)
+	r.GET("/admin-resume-book", middleware.RequireAuth, controllers.AdminResumeBookGet)
+	r.GET("/admin-resume-views", middleware.RequireAuth, controllers.AdminResumeViewsGet)
+	r.GET("/admin-resume-search", middleware.RequireAuth, controllers.AdminResumeSearch)
+	r.GET("/admin-resume-versions", middleware.RequireAuth, controllers.AdminResumeVersionsGet)
+	r.POST("/admin-resume-quota-grant", middleware.RequireAuth, controllers.AdminResumeQuotaGrant)
+
+	r.GET("/sponsor-candidates", middleware.RequireAuth, middleware.RequireSponsor, controllers.SponsorCandidatesGet)
+	r.POST("/sponsor-star", middleware.RequireAuth, middleware.RequireSponsor, controllers.SponsorStarUpdate)
+	r.GET("/sponsor-resume", middleware.RequireAuth, middleware.RequireSponsor, controllers.SponsorResumeGet)
+	r.GET("/sponsor-resume-search", middleware.RequireAuth, middleware.RequireSponsor, controllers.SponsorResumeSearch)
 
 	r.GET("/user-list", middleware.RequireAuth, controllers.GetUserList)
+
+	r.GET("/admin-discord-roles", middleware.RequireAuth, controllers.AdminDiscordRolesGet)
+	r.POST("/admin-discord-roles-update", middleware.RequireAuth, controllers.AdminDiscordRolesUpdate)
+	r.POST("/admin-user-discord-roles-update", middleware.RequireAuth, controllers.AdminUserDiscordRolesUpdate)
+	r.GET("/admin-discord-queue", middleware.RequireAuth, controllers.AdminDiscordQueueGet)
+	r.POST("/admin-discord-dead-letters-requeue", middleware.RequireAuth, controllers.AdminDiscordDeadLettersRequeue)
+	r.POST("/admin-discord-reconcile", middleware.RequireAuth, controllers.AdminDiscordReconcile)
+
+	r.GET("/admin-teams", middleware.RequireAuth, controllers.AdminTeamsGet)
+	r.POST("/admin-team-update", middleware.RequireAuth, controllers.AdminTeamUpdate)
+	r.GET("/admin-badges", middleware.RequireAuth, controllers.AdminBadgesGet)
 	r.Run()
 }
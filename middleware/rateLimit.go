@@ -3,18 +3,42 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/helpers"
+	"github.com/utmmcss/deerhacks-backend/initializers"
 	"github.com/utmmcss/deerhacks-backend/models"
 )
 
+// ResumeUpdateRateLimit rejects uploads from users with no quota left before the upload is processed,
+// sending the remaining quota with every response and Retry-After when the user has to wait for their
+// window to reset. The upload handlers claim the upload again with a conditional update, so concurrent
+// uploads that both pass this check cannot exceed the quota.
 func ResumeUpdateRateLimit(c *gin.Context) {
 	userObj, _ := c.Get("user")
 	user := userObj.(models.User)
 
-	if user.ResumeUpdateCount >= 3 {
-		c.AbortWithStatus(http.StatusTooManyRequests)
-		fmt.Println("UpdateResume - User allowed only 3 update requests")
+	policy := helpers.GetResumeQuotaPolicy()
+	now := time.Now()
+	recentUploads, err := policy.RecentUploads(initializers.DB, user.DiscordId, now)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println("UpdateResume - Failed to find recent resume uploads: ", err)
+		return
+	}
+
+	quota := policy.QuotaFor(user, recentUploads, now)
+	for name, value := range quota.Headers() {
+		c.Header(name, value)
+	}
+
+	if quota.Remaining <= 0 {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":           quota.ExceededMessage(),
+			"remaining_quota": quota.Remaining,
+		})
+		fmt.Println("UpdateResume - User", user.DiscordId, "has no resume uploads remaining")
 		return
 	}
 	c.Next()
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utmmcss/deerhacks-backend/models"
+)
+
+// RequireSponsor limits the sponsor portal to sponsors, and admins previewing it. It runs after
+// RequireAuth. Sponsors are not admins or moderators, so the admin routes stay closed to them.
+func RequireSponsor(c *gin.Context) {
+	userObj, _ := c.Get("user")
+	user := userObj.(models.User)
+
+	if user.Status != models.Sponsor && user.Status != models.Admin {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Sponsors only",
+		})
+		return
+	}
+	c.Next()
+}
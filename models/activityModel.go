@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+type Activity struct {
+	gorm.Model
+	Slug     string `gorm:"unique;size:64"`
+	Name     string `gorm:"size:128"`
+	Points   int
+	IsActive bool // New activities start active unless created disabled (see AdminActivityUpdate)
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/jackc/pgtype"
 	"gorm.io/gorm"
 )
@@ -43,10 +45,13 @@ type Application struct {
 	Education             string `gorm:"size:128"`
 	School                string `gorm:"size:128"`
 	Program               string `gorm:"size:128"`
-	ResumeLink            string `gorm:"size:5000"`
+	GraduationYear        int
 	ResumeFilename        string `gorm:"size:128"`
 	ResumeHash            string `gorm:"size:128"`
-	ResumeExpiry          string `gorm:"size:128"`
+	ResumeKey             string `gorm:"size:256"` // Storage key of the current resume version
+	ResumeScanStatus      string `gorm:"size:32"`
+	ResumeScanSignature   string `gorm:"size:256"`
+	ResumeScannedAt       time.Time
 	Portfolio             string `gorm:"size:128"`
 	Github                string `gorm:"size:128"`
 	Linkedin              string `gorm:"size:128"`
@@ -55,6 +60,7 @@ type Application struct {
 	DeerhacksExperience   pgtype.JSONB `gorm:"type:jsonb;default:'[]'"`
 	TeamPreference        string       `gorm:"size:128"`
 	Interests             pgtype.JSONB `gorm:"type:jsonb;default:'[]'"`
+	Skills                pgtype.JSONB `gorm:"type:jsonb;default:'[]'"`
 	DeerhacksPitch        string       `gorm:"size:1500"`
 	SharedProject         string       `gorm:"size:1500"`
 	FutureTech            string       `gorm:"size:1500"`
@@ -62,4 +68,8 @@ type Application struct {
 	MlhCodeAgreement      bool
 	MlhSubscribe          bool
 	MlhAuthorize          bool
+
+	// Resume text for full text search, only read and written with SQL so it is not loaded with every application
+	ResumeText   string `gorm:"type:text;->:false;<-:false"`
+	ResumeSearch string `gorm:"type:tsvector;index:idx_applications_resume_search,type:gin;->:false;<-:false"`
 }
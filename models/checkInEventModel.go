@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+type CheckInEvent struct {
+	gorm.Model
+	DiscordId string `gorm:"index"`
+	Context   string `gorm:"index;size:64"`
+	Status    Status `gorm:"size:45"` // Status of the scanned user at the time of the check in
+	ScannedBy string
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// Discord queue items that failed too many times, kept for admins to inspect and requeue
+type DiscordDeadLetter struct {
+	gorm.Model
+	DiscordId string `gorm:"index"`
+	Event     string `gorm:"size:20"`
+	Attempts  int
+	LastError string `gorm:"size:1000"`
+	Payload   string `gorm:"type:text"` // Item data needed to requeue it, such as a notification's content
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A pending discord notification, either a DM to DiscordId or a post to the staff channel webhook
+type DiscordNotification struct {
+	gorm.Model
+	Kind          string    `gorm:"size:20"`
+	DiscordId     string    `gorm:"index"`
+	Content       string    `gorm:"type:text"`
+	Attempts      int       `gorm:"default:0"`
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string    `gorm:"size:1000"`
+}
+
+func (DiscordNotification) TableName() string {
+	return "discord_notification_queue"
+}
@@ -0,0 +1,18 @@
+package models
+
+import "gorm.io/gorm"
+
+// Overrides the configured Discord roles for a status, one row per role
+type DiscordRoleMapping struct {
+	gorm.Model
+	Status string `gorm:"index;size:45"`
+	RoleId string `gorm:"size:32"`
+}
+
+// Extra Discord roles granted to a single user on top of their status roles, such as team roles
+type UserDiscordRole struct {
+	gorm.Model
+	DiscordId string `gorm:"index"`
+	RoleId    string `gorm:"size:32"`
+	Reason    string `gorm:"size:128"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type HardwareItem struct {
+	gorm.Model
+	Name        string `gorm:"unique;size:128"`
+	Description string `gorm:"size:500"`
+	Quantity    int
+}
+
+type HardwareCheckout struct {
+	gorm.Model
+	HardwareItemId uint
+	HardwareItem   HardwareItem
+	DiscordId      string `gorm:"index"`
+	Quantity       int
+	DueAt          time.Time
+	ReturnedAt     *time.Time
+	CheckedOutBy   string
+	ReturnedTo     string
+}
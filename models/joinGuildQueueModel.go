@@ -1,12 +1,17 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type JoinGuildQueue struct {
 	gorm.Model
-	DiscordId string `gorm:"unique"`
+	DiscordId     string    `gorm:"unique"`
+	Attempts      int       `gorm:"default:0"`
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string    `gorm:"size:1000"`
 }
 
 func (JoinGuildQueue) TableName() string {
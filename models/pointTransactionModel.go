@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+type PointTransaction struct {
+	gorm.Model
+	DiscordId  string `gorm:"index;uniqueIndex:idx_point_transaction_activity"`
+	ActivityId *uint  `gorm:"uniqueIndex:idx_point_transaction_activity"` // One scan per activity, nil for manual awards
+	Activity   *Activity
+	Points     int
+	Reason     string `gorm:"size:128"`
+	AwardedBy  string
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ResumeBookStatus string
+
+const (
+	ResumeBookPending  ResumeBookStatus = "pending"  // Waiting for the export to start
+	ResumeBookRunning  ResumeBookStatus = "running"  // Collecting resumes into the zip
+	ResumeBookComplete ResumeBookStatus = "complete" // Zip is stored and ready to download
+	ResumeBookFailed   ResumeBookStatus = "failed"   // Export stopped, see Error
+)
+
+// A sponsor resume book export of consenting hackers' resumes, built in the background
+type ResumeBook struct {
+	gorm.Model
+	RequestedBy    string           `gorm:"index"`
+	Status         ResumeBookStatus `gorm:"default:pending"`
+	Statuses       string           `gorm:"size:128"` // Comma separated user statuses included
+	Program        string           `gorm:"size:128"`
+	GraduationYear int
+	Key            string `gorm:"size:256"`
+	ResumeCount    int
+	SkippedCount   int    // Consenting hackers whose resume file could not be read
+	Error          string `gorm:"size:1000"`
+	CompletedAt    *time.Time
+	HeartbeatAt    *time.Time // Updated while an instance is running the export, so stale exports can be failed
+}
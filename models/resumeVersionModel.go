@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// An uploaded resume. Every upload is kept as a new version, and the application's ResumeKey
+// points at the current one.
+type ResumeVersion struct {
+	gorm.Model
+	DiscordId string `gorm:"index"`
+	Key       string `gorm:"size:256"`
+	Hash      string `gorm:"size:128"`
+	Filename  string `gorm:"size:128"`
+	Size      int64
+}
@@ -0,0 +1,19 @@
+package models
+
+import "gorm.io/gorm"
+
+// A candidate a sponsor has starred in the resume portal
+type SponsorStar struct {
+	gorm.Model
+	SponsorId string `gorm:"uniqueIndex:idx_sponsor_star"` // Discord id of the sponsor
+	DiscordId string `gorm:"uniqueIndex:idx_sponsor_star"` // Discord id of the starred hacker
+}
+
+// Logged every time a resume is viewed through the sponsor portal
+type ResumeView struct {
+	gorm.Model
+	ViewerId  string `gorm:"index"` // Discord id of the sponsor
+	DiscordId string `gorm:"index"` // Discord id of the hacker whose resume was viewed
+	IPAddress string `gorm:"size:64"`
+	UserAgent string `gorm:"size:256"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Teams waiting for their discord channels to be created, synced or archived
+type TeamChannelQueue struct {
+	gorm.Model
+	TeamId        uint      `gorm:"unique"`
+	Attempts      int       `gorm:"default:0"`
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string    `gorm:"size:1000"`
+}
+
+func (TeamChannelQueue) TableName() string {
+	return "team_channel_queue"
+}
@@ -0,0 +1,18 @@
+package models
+
+import "gorm.io/gorm"
+
+type Team struct {
+	gorm.Model
+	Name           string `gorm:"unique;size:128"`
+	TextChannelId  string
+	VoiceChannelId string
+	Archived       bool `gorm:"default:false"`
+}
+
+// A user can only be on one team at a time
+type TeamMember struct {
+	gorm.Model
+	TeamId    uint   `gorm:"index"`
+	DiscordId string `gorm:"unique"`
+}
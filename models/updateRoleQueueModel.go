@@ -1,12 +1,17 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type UpdateRoleQueue struct {
 	gorm.Model
-	DiscordId string `gorm:"unique"`
+	DiscordId     string    `gorm:"unique"`
+	Attempts      int       `gorm:"default:0"`
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string    `gorm:"size:1000"`
 }
 
 func (UpdateRoleQueue) TableName() string {
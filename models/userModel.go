@@ -21,6 +21,7 @@ const (
 	Moderator Status = "moderator" // DeerHacks Moderators
 	Volunteer Status = "volunteer" // DeerHacks Volunteers
 	Guest     Status = "guest"     //DeerHacks Guests
+	Sponsor   Status = "sponsor"   // DeerHacks Sponsors, can search consenting attendees' resumes
 )
 
 type User struct {
@@ -39,6 +40,9 @@ type User struct {
 	AuthToken         string
 	RefreshToken      string
 	TokenExpiry       string
+	TokenRevoked      bool `gorm:"default:false"` // Discord refresh token was revoked, the user must log in again
+	NicknameOptOut    bool `gorm:"default:false"` // Keep the user's own discord nickname instead of syncing their name
 	ResumeUpdateCount int
 	EmailChangeCount  int `gorm:"default:0"`
+	ResumeGrantCount  int `gorm:"default:0"` // Extra resume uploads admins granted beyond the lifetime cap
 }
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a local resume URL is tampered with or has expired
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// LocalStore keeps resumes on disk for development. Its presigned URLs point back at the
+// backend's /resume-file route, signed with SECRET so they work without a session.
+type LocalStore struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStore(dir string, baseURL string, secret string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating resume directory: %w", err)
+	}
+	return &LocalStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), secret: []byte(secret)}, nil
+}
+
+// NewLocalStoreFromEnv stores resumes in RESUME_LOCAL_DIR and links to them through RESUME_LOCAL_URL
+func NewLocalStoreFromEnv() (*LocalStore, error) {
+	dir := os.Getenv("RESUME_LOCAL_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	baseURL := os.Getenv("RESUME_LOCAL_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+	return NewLocalStore(dir, baseURL, os.Getenv("SECRET"))
+}
+
+// Maps a key to a path inside the store's directory, rejecting keys that escape it
+func (s *LocalStore) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *LocalStore) Put(key string, body io.ReadSeeker, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial resume
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Get(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *LocalStore) sign(parts ...string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStore) Stat(key string) (ObjectInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+func (s *LocalStore) Presign(key string, filename string, expiry time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("key", key)
+	query.Set("filename", filename)
+	query.Set("expires", expires)
+	query.Set("signature", s.sign("GET", key, filename, expires))
+
+	return s.baseURL + "/resume-file?" + query.Encode(), nil
+}
+
+// Verify checks the query of a URL from Presign, returning the path of the file to serve
+func (s *LocalStore) Verify(key string, filename string, expires string, signature string) (string, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return "", ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign("GET", key, filename, expires))) {
+		return "", ErrInvalidSignature
+	}
+	return s.path(key)
+}
+
+func (s *LocalStore) PresignPut(key string, contentType string, size int64, expiry time.Duration) (PresignedUpload, error) {
+	if _, err := s.path(key); err != nil {
+		return PresignedUpload{}, err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	sizeStr := strconv.FormatInt(size, 10)
+
+	query := url.Values{}
+	query.Set("key", key)
+	query.Set("content_type", contentType)
+	query.Set("size", sizeStr)
+	query.Set("expires", expires)
+	query.Set("signature", s.sign("PUT", key, contentType, sizeStr, expires))
+
+	return PresignedUpload{
+		URL:    s.baseURL + "/resume-file?" + query.Encode(),
+		Method: "PUT",
+		Headers: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": sizeStr,
+		},
+	}, nil
+}
+
+// VerifyPut checks the query of a URL from PresignPut, returning the size the upload must be
+func (s *LocalStore) VerifyPut(key string, contentType string, size string, expires string, signature string) (int64, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return 0, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign("PUT", key, contentType, size, expires))) {
+		return 0, ErrInvalidSignature
+	}
+	return strconv.ParseInt(size, 10, 64)
+}
+
+func (s *LocalStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) List(prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// PresignedUpload is a time limited URL the client uploads a file to directly, sending Headers with it
+type PresignedUpload struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+}
+
+// ResumeStore stores resume files by key. Presign returns a time limited URL that serves the file
+// under filename, with the headers from ResponseHeaders, so the frontend can link to it without going
+// through an authenticated route.
+// PresignPut returns a URL that only accepts an upload of exactly size bytes of contentType.
+type ResumeStore interface {
+	Put(key string, body io.ReadSeeker, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Stat(key string) (ObjectInfo, error)
+	Presign(key string, filename string, expiry time.Duration) (string, error)
+	PresignPut(key string, contentType string, size int64, expiry time.Duration) (PresignedUpload, error)
+	Delete(key string) error
+	List(prefix string) ([]ObjectInfo, error)
+}
+
+var (
+	resumeStore     ResumeStore
+	resumeStoreErr  error
+	resumeStoreOnce sync.Once
+)
+
+// Resumes returns the resume store selected by RESUME_STORAGE ("s3", the default, or "local")
+func Resumes() (ResumeStore, error) {
+	resumeStoreOnce.Do(func() {
+		switch os.Getenv("RESUME_STORAGE") {
+		case "", "s3":
+			resumeStore, resumeStoreErr = NewS3StoreFromEnv()
+		case "local":
+			resumeStore, resumeStoreErr = NewLocalStoreFromEnv()
+		default:
+			resumeStoreErr = fmt.Errorf("unknown RESUME_STORAGE %q", os.Getenv("RESUME_STORAGE"))
+		}
+	})
+	return resumeStore, resumeStoreErr
+}
+
+// SetResumes replaces the resume store, such as with an in memory one for tests
+func SetResumes(store ResumeStore) {
+	resumeStoreOnce.Do(func() {})
+	resumeStore, resumeStoreErr = store, nil
+}
+
+// ResponseHeaders returns the Content-Type and Content-Disposition a stored file is served with.
+// Resumes open in the browser, while resume book zips are downloaded.
+func ResponseHeaders(filename string) (contentType string, disposition string) {
+	contentType, dispositionType := "application/pdf", "inline"
+	if path.Ext(filename) == ".zip" {
+		contentType, dispositionType = "application/zip", "attachment"
+	}
+
+	// Quotes and escapes the user provided filename so it cannot break out of the header
+	disposition = mime.FormatMediaType(dispositionType, map[string]string{"filename": filename})
+	if disposition == "" {
+		disposition = dispositionType
+	}
+	return contentType, disposition
+}
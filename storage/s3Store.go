@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Store keeps resumes in an S3 bucket, or any S3 compatible service such as MinIO
+type S3Store struct {
+	svc    *s3.S3
+	bucket string
+}
+
+// NewS3Store connects to the bucket. An endpoint can be given for S3 compatible services,
+// which are addressed path style since they usually lack bucket subdomains.
+func NewS3Store(bucket string, region string, endpoint string) (*S3Store, error) {
+	config := &aws.Config{
+		Region: aws.String(region),
+	}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %w", err)
+	}
+
+	return &S3Store{svc: s3.New(sess), bucket: bucket}, nil
+}
+
+// NewS3StoreFromEnv connects to RESUME_S3_BUCKET in RESUME_S3_REGION, through RESUME_S3_ENDPOINT if set
+func NewS3StoreFromEnv() (*S3Store, error) {
+	bucket := os.Getenv("RESUME_S3_BUCKET")
+	if bucket == "" {
+		bucket = "dhapplications"
+	}
+	region := os.Getenv("RESUME_S3_REGION")
+	if region == "" {
+		region = "us-east-2"
+	}
+	return NewS3Store(bucket, region, os.Getenv("RESUME_S3_ENDPOINT"))
+}
+
+func (s *S3Store) Put(key string, body io.ReadSeeker, contentType string) error {
+	_, err := s.svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	out, err := s.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3Store) Presign(key string, filename string, expiry time.Duration) (string, error) {
+	contentType, disposition := ResponseHeaders(filename)
+	req, _ := s.svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(disposition),
+		ResponseContentType:        aws.String(contentType),
+	})
+	return req.Presign(expiry)
+}
+
+func (s *S3Store) Stat(key string) (ObjectInfo, error) {
+	out, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(out.ContentLength),
+		LastModified: aws.TimeValue(out.LastModified),
+	}, nil
+}
+
+// Content-Type and Content-Length are part of the signature, so S3 rejects any other file
+func (s *S3Store) PresignPut(key string, contentType string, size int64, expiry time.Duration) (PresignedUpload, error) {
+	req, _ := s.svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	})
+
+	url, err := req.Presign(expiry)
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+
+	return PresignedUpload{
+		URL:    url,
+		Method: "PUT",
+		Headers: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": strconv.FormatInt(size, 10),
+		},
+	}, nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	_, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3Store) List(prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	err := s.svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	return objects, err
+}